@@ -0,0 +1,83 @@
+package main
+
+// csplit サブコマンド
+// split csplit [options] file pattern... のように、GNU csplit と同じパターンで入力を分割する
+// 出力ファイル名は split と同じ仕組み(splitter.Splitter)で組み立てるので、--additional-suffix や --name-template も使える
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/ntk221/split/option"
+	"github.com/ntk221/split/splitter"
+)
+
+const (
+	DefaultCsplitPrefix       = "xx"
+	DefaultCsplitSuffixLength = 2
+	CsplitSynopsys            = `
+	usage:	split csplit [-z] [-f prefix] [-n digits] [--additional-suffix suffix] [--name-template template] file pattern...
+		pattern: line_number | /regexp/[+-offset] | %regexp%[+-offset], optionally followed by {count} or {*}`
+)
+
+func runCsplit(args []string) {
+	fs := flag.NewFlagSet("csplit", flag.ExitOnError)
+	prefixOption := fs.String("f", DefaultCsplitPrefix, "出力ファイル名のprefixを指定してください")
+	digitsOption := fs.Int("n", DefaultCsplitSuffixLength, "出力ファイル名の数字の桁数を指定してください")
+	additionalSuffixOption := fs.String("additional-suffix", "", "出力ファイル名のsuffixの後ろに付け足す文字列を指定してください（例: .txt）")
+	elideEmptyOption := fs.Bool("z", false, "空になるファイルを作成しません")
+	nameTemplateOption := fs.String("name-template", "", "出力ファイル名のテンプレートを指定してください（例: {prefix}-{index:02d}{ext}）")
+	fs.Parse(args)
+
+	rest := fs.Args()
+	if len(rest) < 2 || *digitsOption < 1 {
+		log.Fatal(CsplitSynopsys)
+	}
+
+	patterns, err := option.ParseCsplitPatterns(rest[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// csplit と同様に "-" は標準入力を表す
+	var fileArgs []string
+	if rest[0] != "-" {
+		fileArgs = rest[:1]
+	}
+	file, closeFile := readyFile(fileArgs)
+	defer closeFile()
+	input, ok := detectFileType(file)
+	if !ok {
+		log.Fatal("指定されたファイルはtextファイルではありません")
+	}
+
+	outputDir, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s := splitter.New(*prefixOption)
+	// csplit と同様に -n は最小の桁数として扱い、番号が桁数に収まらなくなったら桁を増やす
+	s.SuffixLength = *digitsOption
+	s.Suffix = splitter.WideningNumericSuffix()
+	s.AdditionalSuffix = *additionalSuffixOption
+	if *nameTemplateOption != "" {
+		s.NameTemplate, err = splitter.ParseNameTemplate(*nameTemplateOption)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	s.InputName = rest[0]
+	s.ElideEmpty = *elideEmptyOption
+
+	cli := &splitter.CLI{
+		Input:     input,
+		OutputDir: outputDir,
+		Splitter:  s,
+	}
+
+	if err := cli.Run(patterns); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+// join サブコマンド
+// split join [options] [prefix] で、split で分割したパートを元の順番に連結する
+// -a, -d, -x, --additional-suffix, --name-template には分割した時と同じ値を指定する
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const JoinSynopsys = `
+	usage:	split join [-a suffix_length] [-d | -x] [--additional-suffix suffix] [--name-template template [--input-name name]]
+			[-o output] [--sha256 checksum] [prefix]`
+
+func runJoin(args []string) {
+	fs := flag.NewFlagSet("join", flag.ExitOnError)
+	naming := addNamingFlags(fs)
+	outputOption := fs.String("o", "", "連結したファイルの出力先を指定してください。指定しない場合は標準出力に書き出します")
+	checksumOption := fs.String("sha256", "", "連結した内容のSHA-256を指定すると、一致するかを確認します")
+	fs.Parse(args)
+
+	rest := fs.Args()
+	if len(rest) > 1 {
+		log.Fatal(JoinSynopsys)
+	}
+	prefix := DefaultPrefix
+	if len(rest) == 1 {
+		prefix = rest[0]
+	}
+
+	dir, s := naming.splitterFor(prefix, JoinSynopsys)
+
+	parts, err := s.FindParts(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var out io.Writer = os.Stdout
+	if *outputOption != "" {
+		for _, part := range parts {
+			if sameFile(filepath.Join(dir, part), *outputOption) {
+				log.Fatalf("出力先にパート %s は指定できません", part)
+			}
+		}
+
+		f, err := os.OpenFile(*outputOption, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	hash := sha256.New()
+	if err := s.Join(context.Background(), dir, parts, io.MultiWriter(out, hash)); err != nil {
+		removeOutput(*outputOption)
+		log.Fatal(err)
+	}
+
+	if *checksumOption != "" {
+		if got := hex.EncodeToString(hash.Sum(nil)); got != strings.ToLower(*checksumOption) {
+			removeOutput(*outputOption)
+			log.Fatalf("SHA-256が一致しません: %s (期待した値: %s)", got, *checksumOption)
+		}
+	}
+}
+
+// sameFile は a と b が同じファイルを指すか否かを返す
+func sameFile(a string, b string) bool {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(infoA, infoB)
+}
+
+// removeOutput は連結に失敗した時に、-o で指定された出力先を削除する
+func removeOutput(output string) {
+	if output != "" {
+		_ = os.Remove(output)
+	}
+}
@@ -4,6 +4,32 @@
 //
 // The options are as follows:
 //
+//		-a suffix_length
+//		 Use suffix_length letters to form the suffix of the file name.
+//		 If this option is not specified, suffixes start with 2 letters and are
+//		 automatically extended when they run out (xyz is followed by xzaaa),
+//		 so that the file names stay in lexicographic order.
+//		 Suffixes are not extended when a from value is given to
+//		 --numeric-suffixes or --hex-suffixes.
+//
+//		-d, --numeric-suffixes[=from]
+//		 Use a numeric suffix instead of an alphabetic suffix.
+//		 If from is specified, suffixes start at from instead of 0.
+//
+//		-x, --hex-suffixes[=from]
+//		 Use a hexadecimal suffix instead of an alphabetic suffix.
+//		 If from is specified, suffixes start at from instead of 0.
+//
+//		--additional-suffix suffix
+//		 Append an additional suffix to output file names (e.g. .csv).
+//		 suffix must not contain a slash.
+//
+//		--name-template template
+//		 Build output file names from template instead of prefix and suffix.
+//		 The placeholders {prefix}, {suffix}, {index} (1-based, e.g. {index:04d}),
+//		 {total} (only with -n, and not with -e -n r/N), {basename} and {ext} of the input file are replaced.
+//		 template must contain {suffix} or {index} so that file names do not collide.
+//
 //		-b byte_count[K|k|M|m|G|g]
 //		 Create split files byte_count bytes in length.
 //		 If k or K is appended to the number,
@@ -13,13 +39,122 @@
 //		 If g or G is appended to the number,
 //		 the file is split into byte_count gigabyte pieces.
 //
+//		-C line_bytes[K|k|M|m|G|g]
+//		 Put as many complete lines as possible into each split file
+//		 without exceeding line_bytes bytes.
+//		 A line is split only when it is longer than line_bytes by itself.
+//
 //		-l line_count
 //		 Create split files line_count lines in length.
 //
+//		-t separator
+//		 Use separator instead of newline as the line (record) separator
+//		 for -l, -C, -p and -n l/, r/. separator may be more than one byte and
+//		 may contain escapes such as \0, \t or \x1e.
+//
+//		-z
+//		 Use NUL as the line separator (same as -t '\0'),
+//		 e.g. to split the output of find -print0.
+//
+//		-p pattern
+//		 The file is split whenever an input line matches pattern,
+//		 which is interpreted as a regular expression (Go RE2 syntax).
+//		 The matching line will be the first line of the next output file.
+//
 //	 	-n chunk_count
 //		 Split file into chunk_count smaller files.
 //		 The first n - 1 files will be of size (size of file / chunk_count ) and
 //		 the last file will contain the remaining bytes.
+//		 If chunk_count is larger than the size of file, each of the first files
+//		 gets a single byte and the rest are empty.
+//
+//		-n l/chunk_count
+//		 Split file into chunk_count files of roughly equal size without splitting lines.
+//		 Each boundary is moved forward to just after the next newline.
+//
+//		-n r/chunk_count
+//		 Distribute lines round robin into chunk_count files.
+//		 The first line goes to the first file, the second line to the second file, and so on.
+//
+//		-n K/chunk_count, -n l/K/chunk_count, -n r/K/chunk_count
+//		 Output only the Kth of the chunk_count chunks to standard output
+//		 instead of creating files.
+//
+//		-e
+//		 With -n, do not create empty output files.
+//		 The remaining files are still named consecutively.
+//
+//		--filter command
+//		 Write each part to the standard input of command, run with sh -c,
+//		 instead of creating a file. The environment variable FILE is set to
+//		 the file name the part would have had (e.g. --filter='gzip > $FILE.gz').
+//		 If command exits with a non-zero status, split exits with the same status.
+//
+//		--filter-jobs job_count
+//		 Run up to job_count filter commands at the same time (default 1).
+//		 It is raised to worker_count, and to chunk_count with -n r/chunk_count.
+//
+//		--verbose
+//		 Print creating file 'name' to the standard output as each output file is opened.
+//
+//		--progress
+//		 Show the number of bytes read, the number of files created, the throughput
+//		 and, when the size of file is known, the estimated time remaining on the standard error.
+//
+//		--manifest manifest_file
+//		 Write a JSON file recording the input name, its size,
+//		 the split mode and its parameter, and for each output file its name,
+//		 byte offset in the input, length, line count and SHA-256.
+//		 The file is rewritten at most once a second while splitting and once more at the end,
+//		 even if the split fails, so a failed run still records the files it created.
+//		 "complete" is true only if the split succeeded.
+//
+//		--binary
+//		 Do not check whether file is a text file.
+//		 This is the default with -b and -n; with -l, -C and -p non-text input is rejected.
+//
+//		--require-text
+//		 Reject non-text input even with -b and -n.
+//
+//		--workers worker_count
+//		 When splitting with -b or -n, write up to worker_count parts concurrently.
+//		 This only takes effect when the input is a regular file.
+//
+// The csplit subcommand splits file at context lines like csplit(1):
+//
+//	split csplit [-z] [-f prefix] [-n digits] [--additional-suffix suffix] [--name-template template] file pattern...
+//
+//	 Each pattern is one of line_number, /regexp/[+-offset] or %regexp%[+-offset]
+//	 (skip up to the matching line without creating a file),
+//	 optionally followed by {count} or {*} to repeat it.
+//	 Output files are named prefix (default xx) followed by a number at least digits (default 2) digits wide
+//	 and the lines after the last pattern go to the last file.
+//	 If a pattern cannot be satisfied, all created files are removed.
+//	 With -z, empty output files are not created.
+//
+// The join subcommand concatenates the parts created by split in order:
+//
+//	split join [-a suffix_length] [-d | -x] [--additional-suffix suffix] [--name-template template [--input-name name]]
+//		[-o output] [--sha256 checksum] [prefix]
+//
+//	 Parts are looked up in the order split names them (including automatically extended suffixes),
+//	 so the same -a, -d, -x, --additional-suffix and --name-template as used for splitting must be given.
+//	 If a part in the middle is missing, nothing is written and join fails.
+//	 The result is written to output (default: standard output).
+//	 If checksum is given, join fails when the SHA-256 of the result does not match it.
+//
+// The verify subcommand checks the parts created by split against their checksums before joining them:
+//
+//	split verify [-a suffix_length] [-d | -x] [--additional-suffix suffix] [--name-template template [--input-name name]]
+//		[--manifest manifest_file] [prefix]
+//
+//	 manifest_file is a file written by --manifest, or a checksum file in the format printed by sha256sum.
+//	 Without --manifest, each part is checked against its own checksum file next to it (xaa.sha256 for xaa).
+//	 Every recorded part is read again from the directory of prefix and reported
+//	 as missing, truncated (shorter than recorded) or corrupted (SHA-256 does not match).
+//	 Parts named like the split output but not recorded are reported as extra,
+//	 or as "no checksum" when checking against per-part checksum files.
+//	 verify exits with a non-zero status if any part is reported.
 //
 // プログラムの実行例: ./split -l 2 test.txt
 //
@@ -27,18 +162,25 @@
 // よって ./split -l2 test.txt のように space を開けない実行が未実装にした
 //
 // textファイルではない入力に関する挙動について man にはそれについて説明がなかった
-// よって、本プログラムの仕様として、text ファイル以外の入力を受け取らないようにした
+// 本プログラムの仕様として、行単位で分割する -l, -C, -p では text ファイル以外の入力を受け取らないようにした
+// バイト単位で分割する -b, -n は大きなバイナリファイルを分割するためにも使うので、デフォルトで text ファイルか否かを判定しない(binary mode)
+// --binary を指定すると常に判定せず、--require-text を指定すると -b, -n でも判定する
 //
-// text ファイルの判定に file コマンドを使用しているのでこのプログラムはfileコマンドが使える環境でなくては動作しない
+// text ファイルの判定は入力の先頭を覗いて sniff package で行うので、file コマンドは必要ない
+// -z や -t '\0' で NUL 文字を区切りにする場合は、NUL 文字を含む入力も受け付ける
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"github.com/ntk221/split/sniff"
 	"github.com/ntk221/split/splitter"
+	"io"
 	"log"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 
 	"github.com/ntk221/split/option"
@@ -47,26 +189,66 @@ import (
 const (
 	DefaultPrefix = "x"
 	Synopsys      = `
-	usage:	split [-l line_count] [file [prefix]]
-		split -b byte_count[K|k|M|m|G|g] [file [prefix]]
-		split -n chunk_count [file [prefix]]`
+	usage:	split [-a suffix_length] [-d | -x] [-t separator | -z] [-l line_count] [file [prefix]]
+		split [-a suffix_length] [-d | -x] [--workers worker_count] -b byte_count[K|k|M|m|G|g] [file [prefix]]
+		split [-a suffix_length] [-d | -x] [-t separator | -z] -p pattern [file [prefix]]
+		split [-a suffix_length] [-d | -x] [-t separator | -z] -C line_bytes[K|k|M|m|G|g] [file [prefix]]
+		split [-a suffix_length] [-d | -x] [-t separator | -z] [--workers worker_count] [-e] -n [l/|r/][K/]chunk_count [file [prefix]]
+		split [--binary | --require-text] [--verbose] [--progress] [--manifest manifest_file] [--filter command [--filter-jobs job_count]] ... [file [prefix]]`
 )
 
 var (
-	lineCountOption  = flag.Int("l", 1000, "行数を指定してください")
-	chunkCountOption = flag.Int("n", 0, "chunk数を指定してください")
-	byteCountOption  = flag.String("b", "", "バイト数を指定してください（例: 10K, 2M, 3G）")
+	lineCountOption    = flag.Int("l", 1000, "行数を指定してください")
+	chunkCountOption   = flag.String("n", "", "chunk数を指定してください（例: 4, l/4, r/4, 2/4, l/2/4）")
+	byteCountOption    = flag.String("b", "", "バイト数を指定してください（例: 10K, 2M, 3G）")
+	lineBytesOption    = flag.String("C", "", "1ファイルあたりの最大バイト数を指定してください（例: 10K, 2M, 3G）")
+	patternOption      = flag.String("p", "", "新しいファイルを始める行の正規表現を指定してください（例: ^=== BEGIN）")
+	suffixLengthOption = flag.Int("a", 0, "出力ファイル名のsuffixの桁数を指定してください")
+	workersOption      = flag.Int("workers", 1, "-b, -n でパートを並列に書き出す数を指定してください")
+
+	numericSuffixOption    = flag.Bool("d", false, "suffixに10進数を使います")
+	hexSuffixOption        = flag.Bool("x", false, "suffixに16進数を使います")
+	numericSuffixesOption  = suffixStartFlag(flag.CommandLine, "numeric-suffixes", "suffixに10進数を使います。値を指定した場合はその値から始めます")
+	hexSuffixesOption      = suffixStartFlag(flag.CommandLine, "hex-suffixes", "suffixに16進数を使います。値を指定した場合はその値から始めます")
+	additionalSuffixOption = flag.String("additional-suffix", "", "出力ファイル名のsuffixの後ろに付け足す文字列を指定してください（例: .csv）")
+	nameTemplateOption     = flag.String("name-template", "", "出力ファイル名のテンプレートを指定してください（例: {prefix}-{index:04d}-of-{total}{ext}）")
+	separatorOption        = flag.String("t", "", "行の区切りとして扱う文字列を指定してください（例: '\\0', '\\x1e'）")
+	nulSeparatorOption     = flag.Bool("z", false, "NUL文字を行の区切りとして扱います")
+	elideEmptyOption       = flag.Bool("e", false, "-n で空になるファイルを作成しません")
+	filterOption           = flag.String("filter", "", "ファイルを作成する代わりに、パートを標準入力に渡すコマンドを指定してください（例: 'gzip > $FILE.gz'）")
+	filterJobsOption       = flag.Int("filter-jobs", 1, "--filter のコマンドを同時に実行する数を指定してください")
+	verboseOption          = flag.Bool("verbose", false, "ファイルを作成するたびにその名前を表示します")
+	binaryOption           = flag.Bool("binary", false, "入力がtextファイルであるか否かを判定しません")
+	requireTextOption      = flag.Bool("require-text", false, "-b, -n でも入力がtextファイルであるか否かを判定します")
+	manifestOption         = flag.String("manifest", "", "作成したパートの記録を書き出すJSONファイルを指定してください")
+	progressOption         = flag.Bool("progress", false, "分割の進み具合を標準エラー出力に表示します")
 )
 
+// modeFlags はファイルの分割方法を指定するoption
+// 分割方法は1つしか指定できない
+var modeFlags = map[string]bool{"l": true, "n": true, "b": true, "C": true, "p": true}
+
 func main() {
+	// split csplit ..., split join ..., split verify ... はサブコマンドとして扱う
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "csplit":
+			runCsplit(os.Args[2:])
+			return
+		case "join":
+			runJoin(os.Args[2:])
+			return
+		case "verify":
+			runVerify(os.Args[2:])
+			return
+		}
+	}
+
 	flag.Parse()
 	args := flag.Args()
 
 	file, closeFile := readyFile(args)
 	defer closeFile()
-	if ok := detectFileType(file); !ok {
-		log.Fatal("指定されたファイルはtextファイルではありません")
-	}
 
 	// 1. ファイル名が指定されている
 	// 2. オプション指定されている
@@ -74,7 +256,7 @@ func main() {
 	// 以上の条件を満たす時、コマンドライン引数の先頭はオプションであるべきである
 	if commandLineArgs := os.Args; len(commandLineArgs) > 2 && len(args) < 2 {
 		first := commandLineArgs[1]
-		if first != "-l" && first != "-n" && first != "-b" {
+		if !strings.HasPrefix(first, "-") {
 			log.Fatal(Synopsys)
 		}
 		if ok := validateOptions(); !ok {
@@ -82,9 +264,31 @@ func main() {
 		}
 	}
 
-	options := []option.Command{option.NewLineCount(*lineCountOption), option.NewChunkCount(*chunkCountOption), option.NewByteCount(*byteCountOption)}
+	chunkCount, err := option.ParseChunkCount(*chunkCountOption)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pattern, err := option.NewPattern(*patternOption)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	options := []option.Command{option.NewLineCount(*lineCountOption), chunkCount, option.NewByteCount(*byteCountOption), option.NewLineBytes(*lineBytesOption), pattern}
 	option := selectOption(options)
 
+	// -a が指定された場合は1桁以上でなくてはならない
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "a" && *suffixLengthOption < 1 {
+			log.Fatal(Synopsys)
+		}
+	})
+
+	suffix, ok := selectSuffix()
+	if !ok {
+		log.Fatal(Synopsys)
+	}
+
 	outputPrefix := DefaultPrefix
 	// 引数でprefixが指定されている場合はそれを使う
 	if len(args) > 1 {
@@ -98,22 +302,86 @@ func main() {
 	}
 
 	s := splitter.New(outputPrefix)
+	s.SuffixLength = *suffixLengthOption
+	s.Suffix = suffix
+	s.AdditionalSuffix = *additionalSuffixOption
+	if *nameTemplateOption != "" {
+		s.NameTemplate, err = splitter.ParseNameTemplate(*nameTemplateOption)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if len(args) > 0 {
+		s.InputName = args[0]
+	}
+	s.Separator, ok = selectSeparator()
+	if !ok {
+		log.Fatal(Synopsys)
+	}
+
+	requireText, ok := selectRequireText(option, s.Separator)
+	if !ok {
+		log.Fatal(Synopsys)
+	}
+	input := io.Reader(file)
+	if requireText {
+		if input, ok = detectFileType(file); !ok {
+			log.Fatal("指定されたファイルはtextファイルではありません（バイナリファイルを分割する場合は --binary を指定してください）")
+		}
+	}
+	s.ElideEmpty = *elideEmptyOption
+	if *verboseOption {
+		s.OnPartCreate = func(index int, name string) {
+			fmt.Printf("creating file '%s'\n", name)
+		}
+	}
+	if *progressOption {
+		s.OnProgress = progressPrinter(os.Stderr)
+	}
+	s.ManifestPath = *manifestOption
+	s.Workers = *workersOption
 
 	cli := &splitter.CLI{
-		Input:     file,
+		Input:     input,
 		OutputDir: outputDir,
 		Splitter:  s,
 	}
+	if *filterOption != "" {
+		cli.Sink = splitter.NewFilterSink(*filterOption, outputDir, filterJobs(option))
+	}
 
 	err = cli.Run(option)
 
 	if err != nil {
-		log.Fatal(err)
+		log.Print(err)
+		os.Exit(exitCode(err))
 	}
 
 	return
 }
 
+// --filter のコマンドを同時に実行する数を返す
+// -b, -n で並列に書き出す場合は worker の数だけ、-n r/N の場合は N 個のパートに同時に書き込むので、その数以上にする
+func filterJobs(opt option.Command) int {
+	jobs := *filterJobsOption
+	if *workersOption > jobs {
+		jobs = *workersOption
+	}
+	if r, ok := opt.(option.RoundRobin); ok && int(r) > jobs {
+		jobs = int(r)
+	}
+	return jobs
+}
+
+// エラーの原因が --filter のコマンドの終了ステータスである場合は、そのステータスで終了する
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		return exitErr.ExitCode()
+	}
+	return 1
+}
+
 // コマンドライン引数でファイル名を指定された場合はそれをオープンして返す
 // コマンドライン引数が指定されない場合は、標準入力から受け取る
 func readyFile(args []string) (file *os.File, close func()) {
@@ -134,27 +402,48 @@ func readyFile(args []string) (file *os.File, close func()) {
 	return file, close
 }
 
-// file コマンドを使ってsplitするファイルがtextファイルであるか否かを判定する
-func detectFileType(file *os.File) bool {
-	cmd := exec.Command("file", "-")
-	cmd.Stdin = file
+// 入力がtextファイルであるか否かを判定するかを返す
+// --binary と --require-text の両方が指定された場合は false を返す
+func selectRequireText(opt option.Command, separator string) (requireText bool, ok bool) {
+	switch {
+	case *binaryOption && *requireTextOption:
+		return false, false
+	case *binaryOption:
+		return false, true
+	case *requireTextOption:
+		return true, true
+	}
+
+	// NUL 文字を区切りにする入力は text ファイルとは判定されない
+	if strings.Contains(separator, "\x00") {
+		return false, true
+	}
+	switch opt.(type) {
+	case option.ByteCount, option.ChunkCount, option.LineChunkCount, option.RoundRobin, option.ExtractChunk:
+		return false, true
+	}
+	return true, true
+}
 
-	output, err := cmd.Output()
+// splitするファイルの先頭を覗いて、textファイルであるか否かを判定する
+// 標準入力のように読み直せない入力でも先頭を失わないように、以降はファイルの代わりに返した io.Reader から読み込む
+func detectFileType(file *os.File) (io.Reader, bool) {
+	prefix, input, err := sniff.Peek(file, sniff.PeekSize)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	if !strings.Contains(string(output), "text") {
-		return false
-	}
-	return true
+	return input, sniff.IsText(prefix)
 }
 
-// 対応するoptionを-n, -l, -bのみに制限した場合、optionのvalidationについては複数指定されているか否かで判定できる
-// この条件を満たさない場合はvalidationについての実装が異なるので拡張する場合は要変更
+// 分割方法を指定するoption(modeFlags)については、複数指定されているか否かで判定できる
+// --workers のように分割方法によらないoptionは数えない
 func validateOptions() bool {
 	optionCount := 0
 	flag.VisitAll(func(f *flag.Flag) {
+		if !modeFlags[f.Name] {
+			return
+		}
 		if f.Value.String() != f.DefValue {
 			optionCount++
 		}
@@ -182,3 +471,96 @@ func selectOption(options []option.Command) option.Command {
 	}
 	return selected
 }
+
+// suffixStart は --numeric-suffixes, --hex-suffixes に指定された suffix の開始値
+// GNU split と同様に値を省略できるように、bool の option として扱う
+// 値を省略した場合は 0 から始める
+type suffixStart struct {
+	set  bool
+	from int
+}
+
+func suffixStartFlag(fs *flag.FlagSet, name string, usage string) *suffixStart {
+	v := &suffixStart{}
+	fs.Var(v, name, usage)
+	return v
+}
+
+func (v *suffixStart) String() string {
+	if v == nil {
+		return "0"
+	}
+	return strconv.Itoa(v.from)
+}
+
+func (v *suffixStart) Set(s string) error {
+	switch s {
+	case "true":
+		v.set, v.from = true, 0
+		return nil
+	case "false":
+		v.set, v.from = false, 0
+		return nil
+	}
+
+	from, err := strconv.Atoi(s)
+	if err != nil || from < 0 {
+		return fmt.Errorf("invalid suffix start: %s", s)
+	}
+	v.set, v.from = true, from
+	return nil
+}
+
+func (v *suffixStart) IsBoolFlag() bool { return true }
+
+// -d, -x, --numeric-suffixes, --hex-suffixes に対応する SuffixGenerator を返す
+// 10進数と16進数の両方が指定された場合は false を返す
+func selectSuffix() (splitter.SuffixGenerator, bool) {
+	return suffixFor(*numericSuffixOption, numericSuffixesOption, *hexSuffixOption, hexSuffixesOption)
+}
+
+// numericShort, hexShort は -d, -x、numericStart, hexStart は --numeric-suffixes, --hex-suffixes の値
+func suffixFor(numericShort bool, numericStart *suffixStart, hexShort bool, hexStart *suffixStart) (splitter.SuffixGenerator, bool) {
+	numeric := numericShort || numericStart.set
+	hex := hexShort || hexStart.set
+
+	switch {
+	case numeric && hex:
+		return nil, false
+	case numeric:
+		return splitter.NumericSuffix(numericStart.from), true
+	case hex:
+		return splitter.HexSuffix(hexStart.from), true
+	}
+	return splitter.AlphabeticSuffix(), true
+}
+
+// -t, -z に対応する行の区切りを返す
+// -t にはバックスラッシュによるエスケープ(\0, \t, \x1e など)を指定できる
+// -t と -z の両方が指定された場合や、-t に空文字列が指定された場合は false を返す
+func selectSeparator() (string, bool) {
+	separatorSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "t" {
+			separatorSet = true
+		}
+	})
+
+	switch {
+	case separatorSet && *nulSeparatorOption:
+		return "", false
+	case *nulSeparatorOption:
+		return "\x00", true
+	case !separatorSet:
+		return splitter.DefaultSeparator, true
+	}
+
+	sep := *separatorOption
+	if sep == `\0` {
+		return "\x00", true
+	}
+	if unquoted, err := strconv.Unquote(`"` + sep + `"`); err == nil {
+		sep = unquoted
+	}
+	return sep, sep != ""
+}
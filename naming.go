@@ -0,0 +1,76 @@
+package main
+
+// join, verify サブコマンドで、分割した時のパートの名前を指定する option
+// パートの名前は分割した時と同じ Splitter の設定から組み立てるので、-a, -d, -x, --additional-suffix, --name-template には分割した時と同じ値を指定する
+
+import (
+	"flag"
+	"log"
+	"path/filepath"
+
+	"github.com/ntk221/split/splitter"
+)
+
+// namingFlags は分割した時のパートの名前を指定する option
+type namingFlags struct {
+	fs               *flag.FlagSet
+	suffixLength     *int
+	numericSuffix    *bool
+	hexSuffix        *bool
+	numericSuffixes  *suffixStart
+	hexSuffixes      *suffixStart
+	additionalSuffix *string
+	nameTemplate     *string
+	inputName        *string
+}
+
+// addNamingFlags は fs にパートの名前を指定する option を追加する
+func addNamingFlags(fs *flag.FlagSet) *namingFlags {
+	return &namingFlags{
+		fs:               fs,
+		suffixLength:     fs.Int("a", 0, "分割した時のsuffixの桁数を指定してください"),
+		numericSuffix:    fs.Bool("d", false, "suffixに10進数を使います"),
+		hexSuffix:        fs.Bool("x", false, "suffixに16進数を使います"),
+		numericSuffixes:  suffixStartFlag(fs, "numeric-suffixes", "suffixに10進数を使います。値を指定した場合はその値から始めます"),
+		hexSuffixes:      suffixStartFlag(fs, "hex-suffixes", "suffixに16進数を使います。値を指定した場合はその値から始めます"),
+		additionalSuffix: fs.String("additional-suffix", "", "分割した時に付け足した文字列を指定してください（例: .csv）"),
+		nameTemplate:     fs.String("name-template", "", "分割した時のテンプレートを指定してください"),
+		inputName:        fs.String("input-name", "", "テンプレートの {basename}, {ext} に使う、分割した入力ファイルの名前を指定してください"),
+	}
+}
+
+// splitterFor は prefix のディレクトリと、そのディレクトリにあるパートの名前を組み立てる Splitter を返す
+// option の指定が不正な場合は synopsys を表示して終了する
+func (n *namingFlags) splitterFor(prefix string, synopsys string) (string, *splitter.Splitter) {
+	// -a が指定された場合は1桁以上でなくてはならない
+	n.fs.Visit(func(f *flag.Flag) {
+		if f.Name == "a" && *n.suffixLength < 1 {
+			log.Fatal(synopsys)
+		}
+	})
+
+	suffix, ok := suffixFor(*n.numericSuffix, n.numericSuffixes, *n.hexSuffix, n.hexSuffixes)
+	if !ok {
+		log.Fatal(synopsys)
+	}
+
+	// prefix にディレクトリが含まれる場合は、そのディレクトリからパートを探す
+	dir, base := filepath.Split(prefix)
+	if dir == "" {
+		dir = "."
+	}
+
+	s := splitter.New(base)
+	s.SuffixLength = *n.suffixLength
+	s.Suffix = suffix
+	s.AdditionalSuffix = *n.additionalSuffix
+	if *n.nameTemplate != "" {
+		var err error
+		s.NameTemplate, err = splitter.ParseNameTemplate(*n.nameTemplate)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	s.InputName = *n.inputName
+	return dir, s
+}
@@ -1,6 +1,8 @@
 package option
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"regexp"
 	"strconv"
@@ -11,6 +13,7 @@ const (
 	DefaultChunkCount = 0
 	DefaultByteCount  = 0
 	DefaultLineCount  = 1000
+	DefaultLineBytes  = 0
 )
 
 type Command interface {
@@ -30,12 +33,130 @@ func NewChunkCount(i int) ChunkCount      { return ChunkCount(i) }
 func (c ChunkCount) IsDefaultValue() bool { return c == DefaultChunkCount }
 func (c ChunkCount) ConvertToNum() uint64 { return uint64(c) }
 
+// LineChunkCount は -n l/N で指定された chunk 数
+// ChunkCount と同様に入力をおおよそ同じサイズに分割するが、行の途中では分割しない
+type LineChunkCount int
+
+func NewLineChunkCount(i int) LineChunkCount  { return LineChunkCount(i) }
+func (c LineChunkCount) IsDefaultValue() bool { return c == DefaultChunkCount }
+func (c LineChunkCount) ConvertToNum() uint64 { return uint64(c) }
+
+// RoundRobin は -n r/N で指定された分割数
+// 入力の各行を N 個のファイルに順番に振り分ける
+type RoundRobin int
+
+func NewRoundRobin(i int) RoundRobin      { return RoundRobin(i) }
+func (r RoundRobin) IsDefaultValue() bool { return r == DefaultChunkCount }
+func (r RoundRobin) ConvertToNum() uint64 { return uint64(r) }
+
+// ChunkKind は -n で指定された chunk の分け方
+type ChunkKind int
+
+const (
+	ByteChunk       ChunkKind = iota // K/N
+	LineChunk                        // l/K/N
+	RoundRobinChunk                  // r/K/N
+)
+
+// ExtractChunk は -n K/N, l/K/N, r/K/N で指定された、N 個に分割した時の K 番目(1始まり)の chunk だけを出力する指定
+type ExtractChunk struct {
+	Kind  ChunkKind
+	Index int // K
+	Count int // N
+}
+
+func NewExtractChunk(kind ChunkKind, k int, n int) ExtractChunk {
+	return ExtractChunk{Kind: kind, Index: k, Count: n}
+}
+func (e ExtractChunk) IsDefaultValue() bool { return false }
+func (e ExtractChunk) ConvertToNum() uint64 { return uint64(e.Count) }
+
+var ErrInvalidChunk = errors.New("chunk数の指定が不正です")
+
+// ParseChunkCount は -n に指定された文字列を解釈する
+// "N" の場合は ChunkCount, "l/N" の場合は LineChunkCount, "r/N" の場合は RoundRobin を返す
+// "K/N", "l/K/N", "r/K/N" の場合は K 番目の chunk だけを出力する ExtractChunk を返す
+// 空文字列の場合はデフォルト値の ChunkCount を返す
+func ParseChunkCount(s string) (Command, error) {
+	if s == "" {
+		return NewChunkCount(DefaultChunkCount), nil
+	}
+
+	fields := strings.Split(s, "/")
+	kind := ByteChunk
+	switch fields[0] {
+	case "l":
+		kind = LineChunk
+		fields = fields[1:]
+	case "r":
+		kind = RoundRobinChunk
+		fields = fields[1:]
+	}
+
+	nums := make([]int, 0, len(fields))
+	for _, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("%s: %w", s, ErrInvalidChunk)
+		}
+		nums = append(nums, n)
+	}
+
+	switch len(nums) {
+	case 1:
+		n := nums[0]
+		switch kind {
+		case LineChunk:
+			return NewLineChunkCount(n), nil
+		case RoundRobinChunk:
+			return NewRoundRobin(n), nil
+		}
+		return NewChunkCount(n), nil
+	case 2:
+		k, n := nums[0], nums[1]
+		if k > n {
+			return nil, fmt.Errorf("%s: %w", s, ErrInvalidChunk)
+		}
+		return NewExtractChunk(kind, k, n), nil
+	}
+	return nil, fmt.Errorf("%s: %w", s, ErrInvalidChunk)
+}
+
 type ByteCount int
 
 func NewByteCount(s string) ByteCount    { return parseByteCount(s) }
 func (b ByteCount) IsDefaultValue() bool { return b == DefaultByteCount }
 func (b ByteCount) ConvertToNum() uint64 { return uint64(b) }
 
+// LineBytes は -C で指定された1ファイルあたりの最大バイト数
+// 行を分断せずに、指定されたバイト数に収まるだけの行を1つのファイルに書き出す
+type LineBytes int
+
+func NewLineBytes(s string) LineBytes    { return LineBytes(parseByteCount(s)) }
+func (l LineBytes) IsDefaultValue() bool { return l == DefaultLineBytes }
+func (l LineBytes) ConvertToNum() uint64 { return uint64(l) }
+
+// Pattern は -p で指定された正規表現
+// 正規表現にマッチする行が現れるたびに新しいファイルに書き出す
+type Pattern struct {
+	Regexp *regexp.Regexp
+}
+
+// NewPattern は s を正規表現として解釈する
+// s が空文字列の場合はデフォルト値(指定なし)の Pattern を返す
+func NewPattern(s string) (Pattern, error) {
+	if s == "" {
+		return Pattern{}, nil
+	}
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return Pattern{}, fmt.Errorf("NewPattern(): %w", err)
+	}
+	return Pattern{Regexp: re}, nil
+}
+func (p Pattern) IsDefaultValue() bool { return p.Regexp == nil }
+func (p Pattern) ConvertToNum() uint64 { return 0 }
+
 func parseByteCount(s string) ByteCount {
 	pattern := regexp.MustCompile(`^(\d+)([KkMmGg]?)$`)
 	match := pattern.FindStringSubmatch(s)
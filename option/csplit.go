@@ -0,0 +1,147 @@
+package option
+
+// csplit サブコマンドに指定されたパターンを表す型
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CsplitKind は csplit のパターンの種類
+type CsplitKind int
+
+const (
+	LineNumber  CsplitKind = iota // N: N行目の直前で分割する
+	MatchRegexp                   // /regexp/[offset]: マッチした行の直前で分割する
+	SkipRegexp                    // %regexp%[offset]: マッチした行の直前までを読み飛ばす
+)
+
+// RepeatForever は {*} が指定されたことを表す
+const RepeatForever = -1
+
+// CsplitPattern は csplit に指定されたパターン1つ分
+type CsplitPattern struct {
+	Kind   CsplitKind
+	Line   int            // LineNumber の場合の行番号(1始まり)
+	Regexp *regexp.Regexp // MatchRegexp, SkipRegexp の場合の正規表現
+	Offset int            // マッチした行からずらす行数
+	Repeat int            // {N} で指定された、追加で繰り返す回数。{*} の場合は RepeatForever
+}
+
+// CsplitPatterns は csplit に指定されたパターンを指定された順に並べたもの
+type CsplitPatterns []CsplitPattern
+
+func (c CsplitPatterns) IsDefaultValue() bool { return len(c) == 0 }
+func (c CsplitPatterns) ConvertToNum() uint64 { return uint64(len(c)) }
+
+// String はパターンを csplit に指定する形式で空白区切りに並べたものを返す
+// ex: "/^=== BEGIN/+1 {*}"
+func (c CsplitPatterns) String() string {
+	args := make([]string, 0, len(c))
+	for _, p := range c {
+		args = append(args, p.String())
+		switch {
+		case p.Repeat == RepeatForever:
+			args = append(args, "{*}")
+		case p.Repeat > 0:
+			args = append(args, "{"+strconv.Itoa(p.Repeat)+"}")
+		}
+	}
+	return strings.Join(args, " ")
+}
+
+// String は繰り返しの指定を除いたパターンを csplit に指定する形式で返す
+func (p CsplitPattern) String() string {
+	if p.Kind == LineNumber {
+		return strconv.Itoa(p.Line)
+	}
+
+	delim := "/"
+	if p.Kind == SkipRegexp {
+		delim = "%"
+	}
+	s := delim + p.Regexp.String() + delim
+	if p.Offset != 0 {
+		s += fmt.Sprintf("%+d", p.Offset)
+	}
+	return s
+}
+
+var ErrInvalidPattern = errors.New("csplitのパターンの指定が不正です")
+
+// ParseCsplitPatterns は csplit に指定されたパターンを解釈する
+// パターンは N, /regexp/[+-offset], %regexp%[+-offset] のいずれかで、直後に {N} か {*} を指定すると繰り返す
+func ParseCsplitPatterns(args []string) (CsplitPatterns, error) {
+	var patterns CsplitPatterns
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "{") && strings.HasSuffix(arg, "}"):
+			if len(patterns) == 0 {
+				return nil, fmt.Errorf("%s: %w", arg, ErrInvalidPattern)
+			}
+			repeat, err := parseRepeat(arg[1 : len(arg)-1])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", arg, err)
+			}
+			patterns[len(patterns)-1].Repeat = repeat
+
+		case strings.HasPrefix(arg, "/"), strings.HasPrefix(arg, "%"):
+			pattern, err := parseRegexpPattern(arg)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", arg, err)
+			}
+			patterns = append(patterns, pattern)
+
+		default:
+			line, err := strconv.Atoi(arg)
+			if err != nil || line <= 0 {
+				return nil, fmt.Errorf("%s: %w", arg, ErrInvalidPattern)
+			}
+			patterns = append(patterns, CsplitPattern{Kind: LineNumber, Line: line})
+		}
+	}
+
+	return patterns, nil
+}
+
+func parseRepeat(s string) (int, error) {
+	if s == "*" {
+		return RepeatForever, nil
+	}
+	repeat, err := strconv.Atoi(s)
+	if err != nil || repeat < 0 {
+		return 0, ErrInvalidPattern
+	}
+	return repeat, nil
+}
+
+// parseRegexpPattern は /regexp/[+-offset] か %regexp%[+-offset] を解釈する
+func parseRegexpPattern(arg string) (CsplitPattern, error) {
+	delim := arg[:1]
+	end := strings.LastIndex(arg, delim)
+	if end == 0 {
+		return CsplitPattern{}, ErrInvalidPattern
+	}
+
+	re, err := regexp.Compile(arg[1:end])
+	if err != nil {
+		return CsplitPattern{}, err
+	}
+
+	offset := 0
+	if rest := arg[end+1:]; rest != "" {
+		offset, err = strconv.Atoi(rest)
+		if err != nil {
+			return CsplitPattern{}, ErrInvalidPattern
+		}
+	}
+
+	kind := MatchRegexp
+	if delim == "%" {
+		kind = SkipRegexp
+	}
+	return CsplitPattern{Kind: kind, Regexp: re, Offset: offset}, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+// --progress で標準エラー出力に表示する分割の進み具合
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ntk221/split/splitter"
+)
+
+// progressPrinter は splitter.Progress を1行に整形して w に上書き表示する
+func progressPrinter(w io.Writer) func(splitter.Progress) {
+	return func(p splitter.Progress) {
+		line := formatBytes(p.BytesRead)
+		if p.TotalBytes >= 0 {
+			percent := 100.0
+			if p.TotalBytes > 0 {
+				percent = float64(p.BytesRead) / float64(p.TotalBytes) * 100
+			}
+			line += fmt.Sprintf(" / %s (%.0f%%)", formatBytes(p.TotalBytes), percent)
+		}
+		line += fmt.Sprintf("  %d parts  %s/s", p.Parts, formatBytes(int64(p.Throughput())))
+		if eta, ok := p.ETA(); ok && !p.Done {
+			line += "  ETA " + eta.Round(time.Second).String()
+		}
+
+		// 前回の表示を消してから上書きする
+		fmt.Fprintf(w, "\r\033[K%s", line)
+		if p.Done {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// formatBytes は n を KiB, MiB, GiB などの単位を付けた文字列にする
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value := float64(n)
+	units := []string{"KiB", "MiB", "GiB", "TiB"}
+	i := -1
+	for value >= unit && i < len(units)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", value, units[i])
+}
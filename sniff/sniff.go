@@ -0,0 +1,104 @@
+// Package sniff は入力の先頭を覗いて、text であるか否かを判定する
+// file コマンドを使わずに判定するので、file コマンドのない環境や標準入力でも使える
+//
+// 判定は以下の順に行う
+//
+//  1. BOM (UTF-8, UTF-16, UTF-32) で始まる場合は text
+//  2. NUL 文字を含む場合は binary
+//  3. UTF-8 として正しい場合は text
+//  4. 改行やタブなど以外の制御文字を含まない場合は、ISO-8859 などの8bitの text
+package sniff
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"unicode/utf8"
+)
+
+// PeekSize は判定に使う入力の先頭のバイト数
+const PeekSize = 8192
+
+var boms = [][]byte{
+	{0xEF, 0xBB, 0xBF},       // UTF-8
+	{0x00, 0x00, 0xFE, 0xFF}, // UTF-32BE
+	{0xFF, 0xFE, 0x00, 0x00}, // UTF-32LE
+	{0xFE, 0xFF},             // UTF-16BE
+	{0xFF, 0xFE},             // UTF-16LE
+}
+
+// Peek は r の先頭 n バイトを、r を読み進めずに返す
+// r がランダムアクセス可能な場合は ReadAt で読み込み、r をそのまま返す
+// そうでない場合は先頭を覗いた *bufio.Reader を返すので、以降は r の代わりにそれを読み込む
+// r が n バイトに満たない場合は、読み込めた分だけを返す
+func Peek(r io.Reader, n int) ([]byte, io.Reader, error) {
+	if ra, ok := r.(io.ReaderAt); ok {
+		if seeker, ok := r.(io.Seeker); ok {
+			if pos, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+				buf := make([]byte, n)
+				m, err := ra.ReadAt(buf, pos)
+				if err == nil || errors.Is(err, io.EOF) {
+					return buf[:m], r, nil
+				}
+			}
+		}
+	}
+
+	reader := bufio.NewReaderSize(r, n)
+	prefix, err := reader.Peek(n)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, err
+	}
+	return prefix, reader, nil
+}
+
+// IsText は prefix が text の先頭であるか否かを返す
+// 空の入力は text とみなす
+func IsText(prefix []byte) bool {
+	for _, bom := range boms {
+		if bytes.HasPrefix(prefix, bom) {
+			return true
+		}
+	}
+
+	if bytes.IndexByte(prefix, 0) >= 0 {
+		return false
+	}
+
+	if utf8.Valid(trimIncompleteRune(prefix)) {
+		return true
+	}
+
+	for _, b := range prefix {
+		if isBinaryControl(b) {
+			return false
+		}
+	}
+	return true
+}
+
+// trimIncompleteRune は先頭を覗いた時に途中で切れてしまった末尾の文字を取り除く
+func trimIncompleteRune(b []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(b); i++ {
+		if utf8.RuneStart(b[len(b)-i]) {
+			if !utf8.FullRune(b[len(b)-i:]) {
+				return b[:len(b)-i]
+			}
+			break
+		}
+	}
+	return b
+}
+
+// isBinaryControl は b が text に現れない制御文字であるか否かを返す
+// 改行やタブ、エスケープシーケンス、ASCII のレコード区切り文字(\x1c-\x1f)は text に現れうる
+func isBinaryControl(b byte) bool {
+	switch {
+	case b == '\t', b == '\n', b == '\v', b == '\f', b == '\r', b == '\b', b == 0x1b:
+		return false
+	case b >= 0x1c && b <= 0x1f:
+		return false
+	}
+	return b < 0x20 || b == 0x7f
+}
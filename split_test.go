@@ -1,12 +1,22 @@
 package main_test
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"flag"
+	"fmt"
 	"github.com/ntk221/split/option"
+	"github.com/ntk221/split/sniff"
 	"github.com/ntk221/split/splitter"
 	"github.com/tenntenn/golden"
+	"io"
 	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -32,15 +42,15 @@ func TestSplitUsingLineCount(t *testing.T) {
 		"largeLineCount": {"hello\n", lineCount(t, math.MaxInt), "x", "bigIntCount"},
 	}
 
-	var s *splitter.Splitter
 	for name, tt := range tests {
+		name, tt := name, tt
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
 			dir := t.TempDir()
 			option := tt.option
 			input := strings.NewReader(tt.input)
-			s = splitter.New(tt.outputPrefix)
+			s := splitter.New(tt.outputPrefix)
 
 			cli := &splitter.CLI{
 				Input:     input,
@@ -75,15 +85,15 @@ func TestSplitUsingByteCount(t *testing.T) {
 		"zeroDivided": {"hello\n", byteCount(t, "0"), "x", "zeroDivided"},
 	}
 
-	var s *splitter.Splitter
 	for name, tt := range tests {
+		name, tt := name, tt
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
 			dir := t.TempDir()
 			option := tt.option
 			input := strings.NewReader(tt.input)
-			s = splitter.New(tt.outputPrefix)
+			s := splitter.New(tt.outputPrefix)
 
 			cli := &splitter.CLI{
 				Input:     input,
@@ -115,18 +125,18 @@ func TestSplitUsingChunkCount(t *testing.T) {
 	}{
 		"simpleCase":        {"HogeHogeHugaHuga", chunkCount(t, 4), "x", "simple", nil},
 		"indivisible":       {"Hi,HowAreYou", chunkCount(t, 3), "x", "indivisible", nil},
-		"tooManyChunkCount": {"hello\n", chunkCount(t, 100), "x", "", splitter.ErrZeroChunk},
+		"tooManyChunkCount": {"hello\n", chunkCount(t, 8), "x", "tooManyChunkCount", nil},
 	}
 
-	var s *splitter.Splitter
 	for name, tt := range tests {
+		name, tt := name, tt
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
 			dir := t.TempDir()
 			option := tt.option
 			input := strings.NewReader(tt.input)
-			s = splitter.New(tt.outputPrefix)
+			s := splitter.New(tt.outputPrefix)
 
 			cli := &splitter.CLI{
 				Input:     input,
@@ -151,6 +161,1320 @@ func TestSplitUsingChunkCount(t *testing.T) {
 	}
 }
 
+func TestSplitUsingLineChunkCount(t *testing.T) {
+	tests := map[string]struct {
+		input        string
+		option       option.Command
+		outputPrefix string
+		wantData     string
+	}{
+		"simpleCase": {"a\nbb\nccc\ndddd\neeeee\n", lineChunkCount(t, 3), "x", "simple"},
+		"longLine":   {"aaaaaaaaaa\nb\n", lineChunkCount(t, 3), "x", "longLine"},
+	}
+
+	for name, tt := range tests {
+		name, tt := name, tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			option := tt.option
+			input := strings.NewReader(tt.input)
+			s := splitter.New(tt.outputPrefix)
+
+			cli := &splitter.CLI{
+				Input:     input,
+				OutputDir: dir,
+				Splitter:  s,
+			}
+
+			err := cli.Run(option)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := golden.Txtar(t, dir)
+
+			if diff := golden.Check(t, flagUpdate, "testdata/lineChunkCount", tt.wantData, got); diff != "" {
+				t.Errorf("Test case %s failed:\n%s", name, diff)
+			}
+		})
+	}
+}
+
+func TestSplitUsingRoundRobin(t *testing.T) {
+	tests := map[string]struct {
+		input        string
+		option       option.Command
+		outputPrefix string
+		wantData     string
+	}{
+		"simpleCase":    {"1\n2\n3\n4\n5\n", roundRobin(t, 2), "x", "simple"},
+		"fewLines":      {"1\n2\n", roundRobin(t, 3), "x", "fewLines"},
+		"noLastNewLine": {"1\n2\n3", roundRobin(t, 2), "x", "noLastNewLine"},
+	}
+
+	for name, tt := range tests {
+		name, tt := name, tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			option := tt.option
+			input := strings.NewReader(tt.input)
+			s := splitter.New(tt.outputPrefix)
+
+			cli := &splitter.CLI{
+				Input:     input,
+				OutputDir: dir,
+				Splitter:  s,
+			}
+
+			err := cli.Run(option)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := golden.Txtar(t, dir)
+
+			if diff := golden.Check(t, flagUpdate, "testdata/roundRobin", tt.wantData, got); diff != "" {
+				t.Errorf("Test case %s failed:\n%s", name, diff)
+			}
+		})
+	}
+}
+
+func TestSplitUsingLineBytes(t *testing.T) {
+	tests := map[string]struct {
+		input        string
+		option       option.Command
+		outputPrefix string
+		wantData     string
+	}{
+		"simpleCase":    {"ab\ncd\nefgh\ni\n", lineBytes(t, "6"), "x", "simple"},
+		"longLine":      {"ab\ncdefghij\nk\n", lineBytes(t, "5"), "x", "longLine"},
+		"noLastNewLine": {"ab\ncd", lineBytes(t, "4"), "x", "noLastNewLine"},
+	}
+
+	for name, tt := range tests {
+		name, tt := name, tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			option := tt.option
+			input := strings.NewReader(tt.input)
+			s := splitter.New(tt.outputPrefix)
+
+			cli := &splitter.CLI{
+				Input:     input,
+				OutputDir: dir,
+				Splitter:  s,
+			}
+
+			err := cli.Run(option)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := golden.Txtar(t, dir)
+
+			if diff := golden.Check(t, flagUpdate, "testdata/lineBytes", tt.wantData, got); diff != "" {
+				t.Errorf("Test case %s failed:\n%s", name, diff)
+			}
+		})
+	}
+}
+
+func TestSplitUsingPattern(t *testing.T) {
+	tests := map[string]struct {
+		input        string
+		pattern      string
+		outputPrefix string
+		wantData     string
+	}{
+		"simpleCase":      {"=== BEGIN 1\nfoo\n=== BEGIN 2\nbar\nbaz\n", "^=== BEGIN", "x", "simple"},
+		"headerBeforeLog": {"header\n=== BEGIN 1\nfoo\n", "^=== BEGIN", "x", "header"},
+		"noMatch":         {"foo\nbar\n", "^=== BEGIN", "x", "noMatch"},
+	}
+
+	for name, tt := range tests {
+		name, tt := name, tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			option, err := option.NewPattern(tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dir := t.TempDir()
+			input := strings.NewReader(tt.input)
+			s := splitter.New(tt.outputPrefix)
+
+			cli := &splitter.CLI{
+				Input:     input,
+				OutputDir: dir,
+				Splitter:  s,
+			}
+
+			err = cli.Run(option)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := golden.Txtar(t, dir)
+
+			if diff := golden.Check(t, flagUpdate, "testdata/pattern", tt.wantData, got); diff != "" {
+				t.Errorf("Test case %s failed:\n%s", name, diff)
+			}
+		})
+	}
+}
+
+func TestSplitUsingCsplitPatterns(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		patterns []string
+		wantData string
+	}{
+		"lineNumber":     {"1\n2\n3\n4\n5\n", []string{"3"}, "lineNumber"},
+		"repeatLine":     {"1\n2\n3\n4\n5\n", []string{"2", "{1}"}, "repeatLine"},
+		"regexpForever":  {"a\nb\na\nb\nc\n", []string{"/a/", "{*}"}, "regexpForever"},
+		"regexpOffset":   {"1\n2\nx\n4\n5\n", []string{"/x/+1"}, "regexpOffset"},
+		"negativeOffset": {"1\n2\nx\n4\n5\n", []string{"/x/-1"}, "negativeOffset"},
+		"skip":           {"header\n=== 1\nfoo\n=== 2\nbar\n", []string{"%^===%", "/^===/", "{*}"}, "skip"},
+	}
+
+	for name, tt := range tests {
+		name, tt := name, tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			option, err := option.ParseCsplitPatterns(tt.patterns)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dir := t.TempDir()
+			s := splitter.New("xx")
+			s.SuffixLength = 2
+			s.Suffix = splitter.NumericSuffix(0)
+
+			cli := &splitter.CLI{
+				Input:     strings.NewReader(tt.input),
+				OutputDir: dir,
+				Splitter:  s,
+			}
+
+			err = cli.Run(option)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := golden.Txtar(t, dir)
+
+			if diff := golden.Check(t, flagUpdate, "testdata/csplit", tt.wantData, got); diff != "" {
+				t.Errorf("Test case %s failed:\n%s", name, diff)
+			}
+		})
+	}
+}
+
+// WideningNumericSuffix では SuffixLength が最小の桁数になり、番号が桁数に収まらなくなっても分割を続けることを確認する
+func TestSplitUsingCsplitPatternsWideningSuffix(t *testing.T) {
+	t.Parallel()
+
+	var input strings.Builder
+	for i := 1; i <= 150; i++ {
+		fmt.Fprintf(&input, "%d\n", i)
+	}
+
+	sink := splitter.NewMemorySink()
+	s := splitter.New("xx")
+	s.SuffixLength = 2
+	s.Suffix = splitter.WideningNumericSuffix()
+	cli := &splitter.CLI{
+		Input:    strings.NewReader(input.String()),
+		Sink:     sink,
+		Splitter: s,
+	}
+
+	if err := cli.Run(csplitPatterns(t, "1", "{148}")); err != nil {
+		t.Fatal(err)
+	}
+
+	names := sink.Names()
+	if len(names) != 150 {
+		t.Fatalf("got %d parts, want 150", len(names))
+	}
+	for name, want := range map[string]string{"xx00": "", "xx99": "99\n", "xx100": "100\n", "xx149": "149\n150\n"} {
+		if got := string(sink.Bytes(name)); got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+}
+
+// パターンを満たせなかった場合はエラーを返し、作成したファイルを全て消去することを確認する
+func TestSplitUsingCsplitPatternsUnsatisfied(t *testing.T) {
+	tests := map[string]struct {
+		patterns []string
+		want     error
+	}{
+		"noMatch":         {[]string{"2", "/zz/"}, splitter.ErrNoMatch},
+		"lineOutOfRange":  {[]string{"2", "10"}, splitter.ErrLineOutOfRange},
+		"lineNotIncrease": {[]string{"3", "2"}, splitter.ErrLineOutOfRange},
+	}
+
+	for name, tt := range tests {
+		name, tt := name, tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			patterns, err := option.ParseCsplitPatterns(tt.patterns)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dir := t.TempDir()
+			cli := &splitter.CLI{
+				Input:     strings.NewReader("1\n2\n3\n4\n"),
+				OutputDir: dir,
+				Splitter:  splitter.New("xx"),
+			}
+
+			if err := cli.Run(patterns); !errors.Is(err, tt.want) {
+				t.Fatalf("%v が返されることを期待しましたが %v でした", tt.want, err)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("ファイルが残っています: %d 個", len(entries))
+			}
+		})
+	}
+}
+
+func TestExtractChunk(t *testing.T) {
+	tests := map[string]struct {
+		input  string
+		option string
+		want   string
+	}{
+		"byteChunk":       {"Hi,HowAreYou", "2/3", "owAr"},
+		"lastByteChunk":   {"Hi,HowAreYou!", "3/3", "eYou!"},
+		"lineChunk":       {"a\nbb\nccc\ndddd\neeeee\n", "l/2/3", "dddd\n"},
+		"emptyLineChunk":  {"aaaaaaaaaa\nb\n", "l/2/3", ""},
+		"roundRobinChunk": {"1\n2\n3\n4\n", "r/2/2", "2\n4\n"},
+	}
+
+	for name, tt := range tests {
+		name, tt := name, tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			opt, err := option.ParseChunkCount(tt.option)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dir := t.TempDir()
+			stdout := &bytes.Buffer{}
+			cli := &splitter.CLI{
+				Input:     strings.NewReader(tt.input),
+				OutputDir: dir,
+				Stdout:    stdout,
+				Splitter:  splitter.New("x"),
+			}
+
+			if err := cli.Run(opt); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("Test case %s failed: got %q, want %q", name, got, tt.want)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("Test case %s failed: パートが作成されています", name)
+			}
+		})
+	}
+}
+
+// 標準入力のようにランダムアクセスできない入力でもchunk単位で分割できることを確認する
+func TestSplitUsingChunkCountFromStream(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cli := &splitter.CLI{
+		Input:     io.MultiReader(strings.NewReader("HogeHoge"), strings.NewReader("HugaHuga")),
+		OutputDir: dir,
+		Splitter:  splitter.New("x"),
+	}
+
+	if err := cli.Run(chunkCount(t, 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	got := golden.Txtar(t, dir)
+
+	if diff := golden.Check(t, flagUpdate, "testdata/chunkCount", "simple", got); diff != "" {
+		t.Errorf("Test case stream failed:\n%s", diff)
+	}
+}
+
+// Workers を指定して並列に書き出しても、順番に書き出した場合と同じパートが作られることを確認する
+func TestSplitInParallel(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		option   option.Command
+		testDir  string
+		wantData string
+	}{
+		"byteCount":  {"Hi,HowAreYou", byteCount(t, "5"), "testdata/byteCount", "indivisible"},
+		"chunkCount": {"Hi,HowAreYou", chunkCount(t, 3), "testdata/chunkCount", "indivisible"},
+	}
+
+	for name, tt := range tests {
+		name, tt := name, tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			s := splitter.New("x")
+			s.Workers = 4
+
+			cli := &splitter.CLI{
+				Input:     strings.NewReader(tt.input),
+				OutputDir: dir,
+				Splitter:  s,
+			}
+
+			if err := cli.Run(tt.option); err != nil {
+				t.Fatal(err)
+			}
+
+			got := golden.Txtar(t, dir)
+
+			if diff := golden.Check(t, flagUpdate, tt.testDir, tt.wantData, got); diff != "" {
+				t.Errorf("Test case %s failed:\n%s", name, diff)
+			}
+		})
+	}
+}
+
+func TestSplitWithSuffixLength(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	s := splitter.New("x")
+	s.SuffixLength = 1
+	cli := &splitter.CLI{
+		Input:     strings.NewReader("1\n2\n3\n"),
+		OutputDir: dir,
+		Splitter:  s,
+	}
+
+	if err := cli.Run(lineCount(t, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"xa", "xb", "xc"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s が作成されていません: %v", name, err)
+		}
+	}
+}
+
+// SuffixLength を指定しない場合は suffix を使い切る前に桁数が増えることを確認する
+func TestSplitWithAutoExtendedSuffix(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cli := &splitter.CLI{
+		Input:     strings.NewReader(strings.Repeat("a\n", 652)),
+		OutputDir: dir,
+		Splitter:  splitter.New("x"),
+	}
+
+	if err := cli.Run(lineCount(t, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 652 {
+		t.Fatalf("652 個のファイルが作成されることを期待しましたが %d 個でした", len(entries))
+	}
+	// os.ReadDir はファイル名の順番に返す
+	for i, want := range map[int]string{0: "xaa", 649: "xyz", 650: "xzaaa", 651: "xzaab"} {
+		if got := entries[i].Name(); got != want {
+			t.Errorf("%d 番目のファイル名: got %s, want %s", i, got, want)
+		}
+	}
+}
+
+func TestSplitWithNumberSuffix(t *testing.T) {
+	tests := map[string]struct {
+		suffix splitter.SuffixGenerator
+		want   []string
+	}{
+		"numeric":     {splitter.NumericSuffix(0), []string{"x00", "x01", "x02"}},
+		"numericFrom": {splitter.NumericSuffix(9), []string{"x09", "x10", "x11"}},
+		"hexFrom":     {splitter.HexSuffix(15), []string{"x0f", "x10", "x11"}},
+		// 開始値が指定されている場合は桁数を自動で増やさないので、先頭が最後の文字でも受け付ける
+		"numericFrom95": {splitter.NumericSuffix(95), []string{"x95", "x96", "x97"}},
+		"hexFromF0":     {splitter.HexSuffix(0xf0), []string{"xf0", "xf1", "xf2"}},
+	}
+
+	for name, tt := range tests {
+		name, tt := name, tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sink := splitter.NewMemorySink()
+			s := splitter.New("x")
+			s.Suffix = tt.suffix
+			cli := &splitter.CLI{
+				Input:    strings.NewReader("1\n2\n3\n"),
+				Sink:     sink,
+				Splitter: s,
+			}
+
+			if err := cli.Run(lineCount(t, 1)); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := sink.Names(); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Test case %s failed: got %v, want %v", name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitWithAdditionalSuffix(t *testing.T) {
+	tests := map[string]struct {
+		option option.Command
+		want   []string
+	}{
+		"lineCount":  {lineCount(t, 2), []string{"xaa.csv", "xab.csv"}},
+		"byteCount":  {byteCount(t, "4"), []string{"xaa.csv", "xab.csv"}},
+		"chunkCount": {chunkCount(t, 2), []string{"xaa.csv", "xab.csv"}},
+	}
+
+	for name, tt := range tests {
+		name, tt := name, tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sink := splitter.NewMemorySink()
+			s := splitter.New("x")
+			s.AdditionalSuffix = ".csv"
+			cli := &splitter.CLI{
+				Input:    strings.NewReader("1\n2\n3\n"),
+				Sink:     sink,
+				Splitter: s,
+			}
+
+			if err := cli.Run(tt.option); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := sink.Names(); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Test case %s failed: got %v, want %v", name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitWithNameTemplate(t *testing.T) {
+	tests := map[string]struct {
+		template string
+		option   option.Command
+		want     []string
+		wantErr  error
+	}{
+		"indexAndTotal":  {"{prefix}-{index:04d}-of-{total}{ext}", chunkCount(t, 2), []string{"x-0001-of-2.log", "x-0002-of-2.log"}, nil},
+		"basename":       {"{basename}.{suffix}", lineCount(t, 2), []string{"access.aa", "access.ab"}, nil},
+		"unknownTotal":   {"{prefix}{index}-of-{total}", lineCount(t, 2), nil, splitter.ErrUnknownTotal},
+		"collidingNames": {"{prefix}{ext}", lineCount(t, 2), nil, splitter.ErrCollidingNames},
+		"unknownHolder":  {"{prefix}{suffix}{foo}", lineCount(t, 2), nil, splitter.ErrInvalidTemplate},
+	}
+
+	for name, tt := range tests {
+		name, tt := name, tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sink := splitter.NewMemorySink()
+			s := splitter.New("x")
+			s.InputName = "/var/log/access.log"
+			cli := &splitter.CLI{
+				Input:    strings.NewReader("1\n2\n3\n"),
+				Sink:     sink,
+				Splitter: s,
+			}
+
+			var err error
+			s.NameTemplate, err = splitter.ParseNameTemplate(tt.template)
+			if err == nil {
+				err = cli.Run(tt.option)
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Test case %s failed: %v が返されることを期待しましたが %v でした", name, tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := sink.Names(); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Test case %s failed: got %v, want %v", name, got, tt.want)
+			}
+		})
+	}
+}
+
+// -t, -z で指定した区切り文字で行を区切ることを確認する
+func TestSplitWithSeparator(t *testing.T) {
+	tests := map[string]struct {
+		input     string
+		separator string
+		option    option.Command
+		want      []string
+	}{
+		"nulLineCount":         {"a\x00bb\x00ccc\x00d", "\x00", lineCount(t, 2), []string{"a\x00bb\x00", "ccc\x00d"}},
+		"recordLineChunkCount": {"r1\x1er2\x1er3\x1e", "\x1e", lineChunkCount(t, 2), []string{"r1\x1er2\x1e", "r3\x1e"}},
+		"multiByteLineBytes":   {"one::two::three::", "::", lineBytes(t, "8"), []string{"one::", "two::", "three::"}},
+		"multiByteRoundRobin":  {"a\r\nb\r\nc\r\n", "\r\n", roundRobin(t, 2), []string{"a\r\nc\r\n", "b\r\n"}},
+		"newlineInRecord":      {"a\nb\x00c\x00", "\x00", lineCount(t, 1), []string{"a\nb\x00", "c\x00"}},
+	}
+
+	for name, tt := range tests {
+		name, tt := name, tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sink := splitter.NewMemorySink()
+			s := splitter.New("x")
+			s.Separator = tt.separator
+			cli := &splitter.CLI{
+				Input:    strings.NewReader(tt.input),
+				Sink:     sink,
+				Splitter: s,
+			}
+
+			if err := cli.Run(tt.option); err != nil {
+				t.Fatal(err)
+			}
+
+			names := sink.Names()
+			if len(names) != len(tt.want) {
+				t.Fatalf("パート数が想定と異なります: %v", names)
+			}
+			for i, name := range names {
+				if got := string(sink.Bytes(name)); got != tt.want[i] {
+					t.Errorf("%s: got %q, want %q", name, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// -e が指定された場合は空のパートを作成せず、残りのパートの名前が連番になることを確認する
+func TestSplitWithElideEmpty(t *testing.T) {
+	tests := map[string]struct {
+		input  string
+		option option.Command
+		want   map[string]string
+	}{
+		"chunkCount":     {"hello\n", chunkCount(t, 8), map[string]string{"xaa": "h", "xab": "e", "xac": "l", "xad": "l", "xae": "o", "xaf": "\n"}},
+		"lineChunkCount": {"aaaa\nb\n", lineChunkCount(t, 4), map[string]string{"xaa": "aaaa\n", "xab": "b\n"}},
+		// chunk 数が入力のバイト数よりはるかに大きくても、chunk 数分の領域を確保せずに入力の終端で打ち切る
+		"hugeChunkCount":     {"hello\n", chunkCount(t, 200000000), map[string]string{"xaa": "h", "xab": "e", "xac": "l", "xad": "l", "xae": "o", "xaf": "\n"}},
+		"hugeLineChunkCount": {"aaaa\nb\n", lineChunkCount(t, 200000000), map[string]string{"xaa": "aaaa\n", "xab": "b\n"}},
+		"hugeRoundRobin":     {"a\nb\n", roundRobin(t, 100000000000), map[string]string{"xaa": "a\n", "xab": "b\n"}},
+		"roundRobin":         {"a\nb\n", roundRobin(t, 4), map[string]string{"xaa": "a\n", "xab": "b\n"}},
+		"csplit":             {"a\nb\na\n", csplitPatterns(t, "/a/", "{*}"), map[string]string{"xaa": "a\nb\n", "xab": "a\n"}},
+	}
+
+	for name, tt := range tests {
+		name, tt := name, tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sink := splitter.NewMemorySink()
+			s := splitter.New("x")
+			s.ElideEmpty = true
+			cli := &splitter.CLI{
+				Input:    strings.NewReader(tt.input),
+				Sink:     sink,
+				Splitter: s,
+			}
+
+			if err := cli.Run(tt.option); err != nil {
+				t.Fatal(err)
+			}
+
+			names := sink.Names()
+			if len(names) != len(tt.want) {
+				t.Fatalf("パート数が想定と異なります: %v", names)
+			}
+			for _, name := range names {
+				if got := string(sink.Bytes(name)); got != tt.want[name] {
+					t.Errorf("%s: got %q, want %q", name, got, tt.want[name])
+				}
+			}
+		})
+	}
+}
+
+// -n r/N で ElideEmpty の場合は、作成するパートの数が分割前に決まらないので {total} を使えないことを確認する
+func TestSplitWithElideEmptyUnknownTotal(t *testing.T) {
+	t.Parallel()
+
+	s := splitter.New("x")
+	s.ElideEmpty = true
+	template, err := splitter.ParseNameTemplate("{prefix}{index}-of-{total}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.NameTemplate = template
+	cli := &splitter.CLI{
+		Input:    strings.NewReader("1\n2\n"),
+		Sink:     splitter.NewMemorySink(),
+		Splitter: s,
+	}
+
+	if err := cli.Run(roundRobin(t, 4)); !errors.Is(err, splitter.ErrUnknownTotal) {
+		t.Errorf("ErrUnknownTotal が返されることを期待しましたが %v でした", err)
+	}
+}
+
+// --filter のコマンドにパートが渡され、終了ステータスがエラーとして返ることを確認する
+func TestSplitWithFilter(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cli := &splitter.CLI{
+		Input:    strings.NewReader("Line1\nLine2\nLine3\n"),
+		Sink:     splitter.NewFilterSink(`tr a-z A-Z > "$FILE.up"`, dir, 1),
+		Splitter: splitter.New("x"),
+	}
+	if err := cli.Run(lineCount(t, 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"xaa.up": "LINE1\nLINE2\n", "xab.up": "LINE3\n"}
+	for name, content := range want {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("%s: got %q, want %q", name, got, content)
+		}
+	}
+
+	cli = &splitter.CLI{
+		Input:    strings.NewReader("Line1\n"),
+		Sink:     splitter.NewFilterSink("cat > /dev/null; exit 3", dir, 1),
+		Splitter: splitter.New("x"),
+	}
+	var exitErr *exec.ExitError
+	if err := cli.Run(lineCount(t, 1)); !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Errorf("終了ステータス 3 の *exec.ExitError が返されることを期待しましたが %v でした", err)
+	}
+	// -n r/N で1つのパートの filter が失敗しても、残りのパートの filter は最後まで実行される
+	rrDir := t.TempDir()
+	cli = &splitter.CLI{
+		Input:    strings.NewReader("1\n2\n3\n"),
+		Sink:     splitter.NewFilterSink(`cat > "$FILE"; [ "$FILE" != xaa ]`, rrDir, 3),
+		Splitter: splitter.New("x"),
+	}
+	if err := cli.Run(roundRobin(t, 3)); !errors.As(err, &exitErr) {
+		t.Errorf("*exec.ExitError が返されることを期待しましたが %v でした", err)
+	}
+	for name, content := range map[string]string{"xab": "2\n", "xac": "3\n"} {
+		got, err := os.ReadFile(filepath.Join(rrDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("%s: got %q, want %q", name, got, content)
+		}
+	}
+}
+
+// -n r/N で ElideEmpty の場合は、後から破棄できない --filter でも空のパートを作成しないことを確認する
+func TestSplitWithFilterElideEmpty(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	var created []string
+	s := splitter.New("x")
+	s.ElideEmpty = true
+	s.OnPartCreate = func(index int, name string) { created = append(created, name) }
+	cli := &splitter.CLI{
+		Input:    strings.NewReader("1\n2\n"),
+		Sink:     splitter.NewFilterSink(`cat > "$FILE"`, dir, 4),
+		Splitter: s,
+	}
+	if err := cli.Run(roundRobin(t, 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	want := []string{"xaa", "xab"}
+	if strings.Join(names, ",") != strings.Join(want, ",") || strings.Join(created, ",") != strings.Join(want, ",") {
+		t.Errorf("got files %v, created %v, want %v", names, created, want)
+	}
+}
+
+// パートを作成するたびに OnPartCreate が呼ばれることを確認する
+func TestSplitWithOnPartCreate(t *testing.T) {
+	t.Parallel()
+
+	var created []string
+	s := splitter.New("x")
+	s.OnPartCreate = func(index int, name string) {
+		created = append(created, fmt.Sprintf("%d:%s", index, name))
+	}
+	cli := &splitter.CLI{
+		Input:    strings.NewReader("Line1\nLine2\nLine3\n"),
+		Sink:     splitter.NewMemorySink(),
+		Splitter: s,
+	}
+
+	if err := cli.Run(lineCount(t, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"0:xaa", "1:xab", "2:xac"}
+	if strings.Join(created, ",") != strings.Join(want, ",") {
+		t.Errorf("got %v, want %v", created, want)
+	}
+}
+
+// 分割が終わった時に、入力全体を読み込んだことが OnProgress に通知されることを確認する
+func TestSplitWithOnProgress(t *testing.T) {
+	tests := map[string]struct {
+		input     io.Reader
+		wantTotal int64
+	}{
+		"sized":   {strings.NewReader("Line1\nLine2\nLine3\n"), 18},
+		"unsized": {io.MultiReader(strings.NewReader("Line1\nLine2\nLine3\n")), -1},
+	}
+
+	for name, tt := range tests {
+		name, tt := name, tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var last splitter.Progress
+			s := splitter.New("x")
+			s.OnProgress = func(p splitter.Progress) { last = p }
+			cli := &splitter.CLI{
+				Input:    tt.input,
+				Sink:     splitter.NewMemorySink(),
+				Splitter: s,
+			}
+
+			if err := cli.Run(lineCount(t, 1)); err != nil {
+				t.Fatal(err)
+			}
+
+			if !last.Done || last.BytesRead != 18 || last.TotalBytes != tt.wantTotal || last.Parts != 3 {
+				t.Errorf("想定外のProgressです: %+v", last)
+			}
+		})
+	}
+}
+
+// --manifest に各パートの位置、バイト数、行数、SHA-256 が記録されることを確認する
+func TestSplitWithManifest(t *testing.T) {
+	t.Parallel()
+
+	input := "Line1\nLine2\nLine3\nLine4\nLine5"
+	s := splitter.New("x")
+	s.InputName = "input.txt"
+	s.ManifestPath = filepath.Join(t.TempDir(), "manifest.json")
+	cli := &splitter.CLI{
+		Input:    strings.NewReader(input),
+		Sink:     splitter.NewMemorySink(),
+		Splitter: s,
+	}
+
+	if err := cli.Run(lineCount(t, 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := splitter.ReadManifest(s.ManifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Input != "input.txt" || m.Size != int64(len(input)) || m.Mode != "lines" || m.Parameter != "2" || !m.Complete {
+		t.Errorf("got %+v", m)
+	}
+
+	wants := []struct {
+		name    string
+		content string
+		offset  int64
+		lines   int64
+	}{
+		{"xaa", "Line1\nLine2\n", 0, 2},
+		{"xab", "Line3\nLine4\n", 12, 2},
+		{"xac", "Line5", 24, 1},
+	}
+	if len(m.Parts) != len(wants) {
+		t.Fatalf("got %d parts, want %d", len(m.Parts), len(wants))
+	}
+	for i, want := range wants {
+		got := m.Parts[i]
+		sum := sha256.Sum256([]byte(want.content))
+		if got.Index != i || got.Name != want.name || got.Offset != want.offset ||
+			got.Length != int64(len(want.content)) || got.Lines != want.lines || got.SHA256 != hex.EncodeToString(sum[:]) {
+			t.Errorf("part %d: got %+v", i, got)
+		}
+	}
+}
+
+// 分割が途中で失敗した場合も、それまでに閉じたパートが Manifest に記録されていることを確認する
+func TestSplitWithManifestFailure(t *testing.T) {
+	t.Parallel()
+
+	s := splitter.New("x")
+	s.ManifestPath = filepath.Join(t.TempDir(), "manifest.json")
+	cli := &splitter.CLI{
+		Input:    strings.NewReader("Line1\nLine2\nLine3\nLine4\n"),
+		Sink:     splitter.NewFilterSink(`cat > /dev/null; [ "$FILE" != xac ]`, t.TempDir(), 1),
+		Splitter: s,
+	}
+
+	if err := cli.Run(lineCount(t, 1)); err == nil {
+		t.Fatal("xac の filter が失敗することを期待しましたが成功しました")
+	}
+
+	m, err := splitter.ReadManifest(s.ManifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, part := range m.Parts {
+		names = append(names, part.Name)
+	}
+	if m.Complete || strings.Join(names, ",") != "xaa,xab" {
+		t.Errorf("got complete %v, parts %v", m.Complete, names)
+	}
+}
+
+// バイナリファイルを -b, -n で分割し、パートを順番に連結すると元のファイルに戻ることを確認する
+func TestSplitBinaryFile(t *testing.T) {
+	want, err := os.ReadFile(filepath.Join("testInputFiles", "archive.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]option.Command{
+		"byteCount":  byteCount(t, "1000"),
+		"chunkCount": chunkCount(t, 3),
+	}
+
+	for name, opt := range tests {
+		name, opt := name, opt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sink := splitter.NewMemorySink()
+			cli := &splitter.CLI{
+				Input:    bytes.NewReader(want),
+				Sink:     sink,
+				Splitter: splitter.New("x"),
+			}
+			if err := cli.Run(opt); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []byte
+			for _, name := range sink.Names() {
+				got = append(got, sink.Bytes(name)...)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("連結したパートが元のファイルと一致しません: %d bytes, want %d bytes", len(got), len(want))
+			}
+		})
+	}
+}
+
+// 分割したパートを FindParts, Join で連結すると元の入力に戻ることを確認する
+func TestJoin(t *testing.T) {
+	tests := map[string]struct {
+		input     string
+		option    option.Command
+		configure func(s *splitter.Splitter)
+	}{
+		"alphabetic":   {"Line1\nLine2\nLine3\n", lineCount(t, 1), func(s *splitter.Splitter) {}},
+		"autoExtended": {strings.Repeat("a\n", 700), lineCount(t, 1), func(s *splitter.Splitter) {}},
+		"numeric": {strings.Repeat("a\n", 10), lineCount(t, 1), func(s *splitter.Splitter) {
+			s.SuffixLength = 1
+			s.Suffix = splitter.NumericSuffix(0)
+			s.AdditionalSuffix = ".txt"
+		}},
+		"template": {"Line1\nLine2\nLine3\n", lineChunkCount(t, 3), func(s *splitter.Splitter) {
+			s.NameTemplate, _ = splitter.ParseNameTemplate("{basename}-{index}-of-{total}{ext}")
+			s.InputName = "input.log"
+		}},
+	}
+
+	for name, tt := range tests {
+		name, tt := name, tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			s := splitter.New("x")
+			tt.configure(s)
+			cli := &splitter.CLI{
+				Input:     strings.NewReader(tt.input),
+				OutputDir: dir,
+				Splitter:  s,
+			}
+			if err := cli.Run(tt.option); err != nil {
+				t.Fatal(err)
+			}
+
+			parts, err := s.FindParts(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got bytes.Buffer
+			if err := s.Join(context.Background(), dir, parts, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != tt.input {
+				t.Errorf("連結した内容が元の入力と一致しません: %q", got.String())
+			}
+		})
+	}
+}
+
+// 途中のパートが欠けている場合は ErrMissingPart を返すことを確認する
+func TestJoinMissingPart(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	s := splitter.New("x")
+	cli := &splitter.CLI{
+		Input:     strings.NewReader("Line1\nLine2\nLine3\n"),
+		OutputDir: dir,
+		Splitter:  s,
+	}
+	if err := cli.Run(lineCount(t, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "xab")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.FindParts(dir); !errors.Is(err, splitter.ErrMissingPart) || !strings.Contains(err.Error(), "xab") {
+		t.Errorf("xab が欠けていることを示す ErrMissingPart が返されることを期待しましたが %v でした", err)
+	}
+}
+
+// パートを壊した時に、Manifest との照合で欠けている、短い、内容が異なる、余分なパートが報告されることを確認する
+func TestVerify(t *testing.T) {
+	tests := map[string]struct {
+		manifest func(t *testing.T, s *splitter.Splitter, dir string, m *splitter.Manifest) *splitter.Manifest
+		want     []string
+	}{
+		"manifest": {
+			manifest: func(t *testing.T, s *splitter.Splitter, dir string, m *splitter.Manifest) *splitter.Manifest {
+				return m
+			},
+			want: []string{"xaa:truncated", "xab:corrupted", "xac:missing", "xad:OK", "xaf:extra"},
+		},
+		"checksums": {
+			manifest: func(t *testing.T, s *splitter.Splitter, dir string, m *splitter.Manifest) *splitter.Manifest {
+				var b strings.Builder
+				for _, part := range m.Parts {
+					fmt.Fprintf(&b, "%s  %s\n", part.SHA256, part.Name)
+				}
+				path := filepath.Join(t.TempDir(), "SHA256SUMS")
+				if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+					t.Fatal(err)
+				}
+				checksums, err := splitter.ReadManifest(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// チェックサムファイルには入力ファイルの名前が記録されていない
+				if checksums.Input != "" {
+					t.Errorf("Input: got %q, want empty", checksums.Input)
+				}
+				return checksums
+			},
+			// チェックサムファイルにはバイト数が記録されていないので、短いパートも内容が異なるパートとして報告される
+			want: []string{"xaa:corrupted", "xab:corrupted", "xac:missing", "xad:OK", "xaf:extra"},
+		},
+		"sidecars": {
+			manifest: func(t *testing.T, s *splitter.Splitter, dir string, m *splitter.Manifest) *splitter.Manifest {
+				// xad のチェックサムファイルだけを作らない
+				for _, part := range m.Parts {
+					if part.Name == "xad" {
+						continue
+					}
+					line := fmt.Sprintf("%s  %s\n", part.SHA256, part.Name)
+					if err := os.WriteFile(filepath.Join(dir, part.Name+splitter.SidecarSuffix), []byte(line), 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				sidecars, err := s.ReadSidecars(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return sidecars
+			},
+			// チェックサムファイルがないパートは余分なパートではなく、照合できないパートとして報告される
+			want: []string{"xaa:corrupted", "xab:corrupted", "xac:missing", "xad:no checksum", "xaf:no checksum"},
+		},
+	}
+
+	for name, tt := range tests {
+		name, tt := name, tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			s := splitter.New("x")
+			s.ManifestPath = filepath.Join(t.TempDir(), "manifest.json")
+			cli := &splitter.CLI{
+				Input:     strings.NewReader("Line1\nLine2\nLine3\nLine4\n"),
+				OutputDir: dir,
+				Splitter:  s,
+			}
+			if err := cli.Run(lineCount(t, 1)); err != nil {
+				t.Fatal(err)
+			}
+			m, err := splitter.ReadManifest(s.ManifestPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// xaa を短くし、xab の内容を変え、xac を消し、余分な xaf を作る
+			files := map[string]string{"xaa": "Line", "xab": "line2\n", "xaf": "Line6\n"}
+			for name, content := range files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.Remove(filepath.Join(dir, "xac")); err != nil {
+				t.Fatal(err)
+			}
+
+			results, err := s.Verify(context.Background(), dir, tt.manifest(t, s, dir, m))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]string, 0, len(results))
+			for _, result := range results {
+				got = append(got, result.Name+":"+result.Status.String())
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSniffIsText(t *testing.T) {
+	tests := map[string]struct {
+		input string
+		want  bool
+	}{
+		"ascii":           {"hello\nworld\n", true},
+		"empty":           {"", true},
+		"utf8":            {"こんにちは\n", true},
+		"truncatedRune":   {"こんにちは"[:7], true},
+		"utf8BOM":         {"\xef\xbb\xbfhello\n", true},
+		"utf16BOM":        {"\xff\xfeh\x00i\x00", true},
+		"latin1":          {"caf\xe9\n", true},
+		"recordSeparator": {"r1\x1er2\x1e", true},
+		"nul":             {"a\x00b\n", false},
+		"controlBytes":    {"\x89PNG\r\n\x1a\n\xff\x01", false},
+	}
+
+	for name, tt := range tests {
+		name, tt := name, tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := sniff.IsText([]byte(tt.input)); got != tt.want {
+				t.Errorf("IsText(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSniffInputFiles(t *testing.T) {
+	tests := map[string]bool{
+		"100Line.txt":   true,
+		"utf8file.txt":  true,
+		"utf16file.txt": true,
+		"archive.tar":   false,
+	}
+
+	for name, want := range tests {
+		name, want := name, want
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := os.Open(filepath.Join("testInputFiles", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			prefix, _, err := sniff.Peek(f, sniff.PeekSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sniff.IsText(prefix); got != want {
+				t.Errorf("%s: got %v, want %v", name, got, want)
+			}
+		})
+	}
+}
+
+// 先頭を覗いた後も、返された io.Reader から入力全体を読み込めることを確認する
+func TestSniffPeekKeepsInput(t *testing.T) {
+	tests := map[string]io.Reader{
+		"readerAt": strings.NewReader("hello\nworld\n"),
+		"stream":   io.MultiReader(strings.NewReader("hello\nworld\n")),
+	}
+
+	for name, r := range tests {
+		name, r := name, r
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			prefix, input, err := sniff.Peek(r, 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(prefix) != "hello" {
+				t.Errorf("prefix: got %q", prefix)
+			}
+			if all, _ := io.ReadAll(input); string(all) != "hello\nworld\n" {
+				t.Errorf("input: got %q", all)
+			}
+		})
+	}
+}
+
+// suffix を使い切った場合は ErrTooManyFile を返し、作成したファイルを全て消去することを確認する
+func TestSplitTooManyFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	s := splitter.New("x")
+	s.SuffixLength = 1
+	s.AdditionalSuffix = ".txt"
+	cli := &splitter.CLI{
+		Input:     strings.NewReader(strings.Repeat("a\n", 27)),
+		OutputDir: dir,
+		Splitter:  s,
+	}
+
+	if err := cli.Run(lineCount(t, 1)); !errors.Is(err, splitter.ErrTooManyFile) {
+		t.Fatalf("ErrTooManyFile が返されることを期待しましたが %v でした", err)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("ファイルが残っています: %d 個", len(entries))
+	}
+}
+
+// 入力がちょうど suffix の数だけのパートに収まる場合は ErrTooManyFile にならないことを確認する
+func TestSplitExactlyFillsSuffix(t *testing.T) {
+	t.Parallel()
+
+	sink := splitter.NewMemorySink()
+	s := splitter.New("x")
+	s.SuffixLength = 1
+	cli := &splitter.CLI{
+		Input:    strings.NewReader(strings.Repeat("a\n", 26)),
+		Sink:     sink,
+		Splitter: s,
+	}
+
+	if err := cli.Run(lineCount(t, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	names := sink.Names()
+	if len(names) != 26 || names[0] != "xa" || names[25] != "xz" {
+		t.Errorf("got %v", names)
+	}
+}
+
+func TestSplitReturnsPartError(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join(t.TempDir(), "notExist")
+	cli := &splitter.CLI{
+		Input:     strings.NewReader("hello\n"),
+		OutputDir: dir,
+		Splitter:  splitter.New("x"),
+	}
+
+	err := cli.Run(lineCount(t, 1))
+
+	var perr *splitter.PartError
+	if !errors.As(err, &perr) {
+		t.Fatalf("*splitter.PartError が返されることを期待しましたが %v でした", err)
+	}
+	if perr.Op != "open" || perr.Part != "xaa" || perr.Offset != 0 {
+		t.Errorf("想定外のPartErrorです: %+v", perr)
+	}
+}
+
+func TestSplitToMemorySink(t *testing.T) {
+	t.Parallel()
+
+	sink := splitter.NewMemorySink()
+	cli := &splitter.CLI{
+		Input:    strings.NewReader("Line1\nLine2\nLine3\n"),
+		Sink:     sink,
+		Splitter: splitter.New("x"),
+	}
+
+	if err := cli.Run(lineCount(t, 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"xaa": "Line1\nLine2\n", "xab": "Line3\n"}
+	names := sink.Names()
+	if len(names) != len(want) {
+		t.Fatalf("パート数が想定と異なります: %v", names)
+	}
+	for _, name := range names {
+		if got := string(sink.Bytes(name)); got != want[name] {
+			t.Errorf("%s: got %q, want %q", name, got, want[name])
+		}
+	}
+}
+
 func lineCount(t *testing.T, n int) option.Command {
 	t.Helper()
 
@@ -163,8 +1487,36 @@ func chunkCount(t *testing.T, n int) option.Command {
 	return option.NewChunkCount(n)
 }
 
+func lineChunkCount(t *testing.T, n int) option.Command {
+	t.Helper()
+
+	return option.NewLineChunkCount(n)
+}
+
+func roundRobin(t *testing.T, n int) option.Command {
+	t.Helper()
+
+	return option.NewRoundRobin(n)
+}
+
+func lineBytes(t *testing.T, b string) option.Command {
+	t.Helper()
+
+	return option.NewLineBytes(b)
+}
+
 func byteCount(t *testing.T, b string) option.Command {
 	t.Helper()
 
 	return option.NewByteCount(b)
 }
+
+func csplitPatterns(t *testing.T, patterns ...string) option.Command {
+	t.Helper()
+
+	c, err := option.ParseCsplitPatterns(patterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
@@ -0,0 +1,284 @@
+package splitter
+
+// csplit と同様に、行番号や正規表現にマッチした行を境界として入力を分割する
+// パターンの意味は GNU csplit に合わせている
+//
+//	N                 N行目の直前までを1つのパートにする。{M} を付けると 2N, 3N, ... 行目でも分割する
+//	/regexp/[offset]  regexp にマッチする行の直前までを1つのパートにする。offset 行だけ境界をずらせる
+//	%regexp%[offset]  /regexp/ と同様だが、境界までの行はパートにせずに読み飛ばす
+//	{N}, {*}          直前のパターンを N 回、または満たせなくなるまで繰り返す
+//
+// 最後のパターンの後に残った行は最後のパートに書き出す
+// 正規表現は直前に正規表現でマッチした行の次の行から探すので、/regexp/ {*} はマッチした行ごとにパートを分ける
+// {*} 以外でパターンを満たせなかった場合は、作成した全てのパートを破棄してエラーを返す
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ntk221/split/option"
+)
+
+var (
+	ErrNoMatch        = errors.New("パターンにマッチする行がありません")
+	ErrLineOutOfRange = errors.New("行番号が入力の範囲外です")
+)
+
+// csplitter は csplit で分割している途中の状態
+type csplitter struct {
+	s      *Splitter
+	ctx    context.Context
+	sink   OutputSink
+	reader *recordReader
+
+	pending    []string // 読み込んだが、まだ書き出しも読み飛ばしもしていない行
+	next       int      // pending[0] の行番号(1始まり)
+	offset     int64    // pending[0] の先頭が入力の何バイト目にあたるか
+	eof        bool
+	searchFrom int // 次に正規表現で探し始める行番号
+
+	index   int
+	suffix  string
+	current *part
+	created []string
+}
+
+func (s *Splitter) splitUsingCsplitPatterns(ctx context.Context, file io.Reader, sink OutputSink, csplitOption option.Command) error {
+	var patterns option.CsplitPatterns
+	var ok bool
+	if patterns, ok = csplitOption.(option.CsplitPatterns); !ok {
+		panic("SplitUsingCsplitPatternsがCsplitPatterns以外のCommandOptionで呼ばれている")
+	}
+	if len(patterns) == 0 {
+		return fmt.Errorf("splitUsingCsplitPatterns(): %w", ErrUnknownMode)
+	}
+
+	c := &csplitter{
+		s:          s,
+		ctx:        ctx,
+		sink:       sink,
+		reader:     newRecordReader(file, s.separator()),
+		next:       1,
+		searchFrom: 1,
+		suffix:     s.firstSuffix(),
+	}
+	if err := c.run(patterns); err != nil {
+		c.abort()
+		return err
+	}
+	return nil
+}
+
+func (c *csplitter) run(patterns option.CsplitPatterns) error {
+	for _, pattern := range patterns {
+		forever := pattern.Repeat == option.RepeatForever
+		for repetition := 0; forever || repetition <= pattern.Repeat; repetition++ {
+			if err := c.ctx.Err(); err != nil {
+				return err
+			}
+
+			err := c.apply(pattern, repetition)
+			// {*} はパターンを満たせなくなった時点で終わる
+			if forever && (errors.Is(err, ErrNoMatch) || errors.Is(err, ErrLineOutOfRange)) {
+				return c.finish()
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return c.finish()
+}
+
+// apply は pattern を repetition 回目(0始まり)の繰り返しとして適用する
+// パターンを満たせなかった場合は ErrNoMatch か ErrLineOutOfRange をラップしたエラーを返す
+func (c *csplitter) apply(pattern option.CsplitPattern, repetition int) error {
+	if pattern.Kind == option.LineNumber {
+		until := pattern.Line * (repetition + 1)
+		if until < c.next {
+			return fmt.Errorf("%d: %w", until, ErrLineOutOfRange)
+		}
+		if ok, err := c.advance(until, false); err != nil || !ok {
+			return outOfRange(until, err)
+		}
+		return c.cut()
+	}
+
+	skip := pattern.Kind == option.SkipRegexp
+	// 負の offset で境界を前にずらせるように、検索中の行の直前 hold 行は書き出さずに残しておく
+	hold := 0
+	if pattern.Offset < 0 {
+		hold = -pattern.Offset
+	}
+
+	n := c.next
+	if n < c.searchFrom {
+		n = c.searchFrom
+	}
+	for ; ; n++ {
+		if err := c.ctx.Err(); err != nil {
+			return err
+		}
+		line, ok, err := c.line(n)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%s: %w", pattern.Regexp, ErrNoMatch)
+		}
+		if pattern.Regexp.MatchString(strings.TrimSuffix(line, c.s.separator())) {
+			break
+		}
+		if err := c.emit(n-hold, skip); err != nil {
+			return err
+		}
+	}
+
+	until := n + pattern.Offset
+	if until < c.next {
+		return fmt.Errorf("%d: %w", until, ErrLineOutOfRange)
+	}
+	if ok, err := c.advance(until, skip); err != nil || !ok {
+		return outOfRange(until, err)
+	}
+
+	// 同じ行に何度もマッチしないように、マッチした行より後ろから次の検索を始める
+	c.searchFrom = until + 1
+	if c.searchFrom <= n {
+		c.searchFrom = n + 1
+	}
+	if skip {
+		return nil
+	}
+	return c.cut()
+}
+
+// finish は残りの行を全て最後のパートに書き出す
+func (c *csplitter) finish() error {
+	for {
+		_, ok, err := c.line(c.next)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return c.cut()
+		}
+		if err := c.emit(c.next+1, false); err != nil {
+			return err
+		}
+	}
+}
+
+// line は行番号 n の行を返す
+// n 行目まで読み込んでいなければ reader から読み込み、入力が n 行に満たない場合は false を返す
+// 事前条件: n >= c.next
+func (c *csplitter) line(n int) (string, bool, error) {
+	for !c.eof && c.next+len(c.pending) <= n {
+		lines, err := readLines(1, c.reader)
+		c.pending = append(c.pending, lines...)
+		if errors.Is(err, io.EOF) {
+			c.eof = true
+		} else if err != nil {
+			return "", false, &PartError{Op: "read", Part: c.s.partName(c.index, c.suffix, unknownTotal), Offset: c.offset, Err: err}
+		}
+	}
+
+	if n-c.next >= len(c.pending) {
+		return "", false, nil
+	}
+	return c.pending[n-c.next], true, nil
+}
+
+// advance は行番号 until の直前までの行を、入力から読み込みながら書き出す
+// 入力が until - 1 行に満たない場合は false を返す
+func (c *csplitter) advance(until int, skip bool) (bool, error) {
+	for c.next < until {
+		_, ok, err := c.line(c.next)
+		if err != nil || !ok {
+			return false, err
+		}
+		if err := c.emit(c.next+1, skip); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// emit は読み込み済みの行のうち、行番号 until の直前までの行を現在のパートに書き出す
+// skip が true の場合は書き出さずに捨てる
+func (c *csplitter) emit(until int, skip bool) error {
+	for c.next < until && len(c.pending) > 0 {
+		line := c.pending[0]
+		if !skip {
+			if err := c.open(); err != nil {
+				return err
+			}
+			if _, err := c.current.Write([]byte(line)); err != nil {
+				return err
+			}
+		}
+		c.pending = c.pending[1:]
+		c.next++
+		c.offset += int64(len(line))
+	}
+	return nil
+}
+
+// open は現在のパートをまだ作成していなければ作成する
+func (c *csplitter) open() error {
+	if c.current != nil {
+		return nil
+	}
+	if c.s.suffixExhausted(c.suffix) {
+		return ErrTooManyFile
+	}
+
+	name := c.s.partName(c.index, c.suffix, unknownTotal)
+	p, err := createPart(c.sink, c.index, name, c.offset)
+	if err != nil {
+		return err
+	}
+	c.current = p
+	c.created = append(c.created, name)
+	return nil
+}
+
+// cut は現在のパートを閉じて次のパートに進む
+// 1行も書き出していない場合も空のパートを作成する
+// ElideEmpty が true の場合は空のパートを作成せず、その名前を次のパートに使う
+func (c *csplitter) cut() error {
+	if c.current == nil && c.s.ElideEmpty {
+		return nil
+	}
+	if err := c.open(); err != nil {
+		return err
+	}
+	err := c.current.Close()
+	c.current = nil
+	c.index++
+	c.suffix = c.s.nextSuffix(c.suffix)
+	return err
+}
+
+// abort はエラーが発生した時に、作成した全てのパートを破棄する
+// 元のエラーを呼び出し元に返すため、ここで発生したエラーは無視する
+func (c *csplitter) abort() {
+	if c.current != nil {
+		_ = c.current.w.Close()
+		c.current = nil
+	}
+	for _, name := range c.created {
+		_ = c.sink.Abort(name)
+	}
+}
+
+// outOfRange は advance が入力の終わりに達した場合のエラーを返す
+func outOfRange(until int, err error) error {
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%d: %w", until, ErrLineOutOfRange)
+}
@@ -0,0 +1,108 @@
+package splitter
+
+// --filter で指定されたコマンドにパートを渡す OutputSink
+// パートごとにシェルを起動し、環境変数 FILE にパートの名前を設定して、パートの内容を標準入力に流し込む
+// ex: --filter='gzip > $FILE.gz' の場合は、xaa.gz, xab.gz, ... が作成される
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// FilterSink はパートをファイルに書き出す代わりに、Command の標準入力に書き込む OutputSink
+type FilterSink struct {
+	// Command はパートごとに sh -c で実行するコマンド
+	Command string
+	// Dir はコマンドを実行するディレクトリで、空文字列の場合はカレントディレクトリ
+	Dir string
+	// Stdout, Stderr はコマンドの標準出力と標準エラー出力
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// sem は同時に実行するコマンドの数を制限する
+	// 空きがない場合、Create は実行中のコマンドが終わるまで待つ
+	sem chan struct{}
+}
+
+// NewFilterSink は同時に maxRunning 個までコマンドを実行する FilterSink を返す
+// -n r/N のように複数のパートに同時に書き込む場合、maxRunning はその数以上でなくてはならない
+// maxRunning が 1 未満の場合は 1 として扱う
+func NewFilterSink(command string, dir string, maxRunning int) *FilterSink {
+	if maxRunning < 1 {
+		maxRunning = 1
+	}
+	return &FilterSink{
+		Command: command,
+		Dir:     dir,
+		Stdout:  os.Stdout,
+		Stderr:  os.Stderr,
+		sem:     make(chan struct{}, maxRunning),
+	}
+}
+
+// Create は name をパートの名前としてコマンドを起動し、その標準入力を返す
+// 返した io.WriteCloser の Close はコマンドの終了を待ち、終了ステータスが0でない場合は *exec.ExitError を返す
+func (f *FilterSink) Create(index int, name string) (io.WriteCloser, error) {
+	f.sem <- struct{}{}
+
+	cmd := exec.Command("sh", "-c", f.Command)
+	cmd.Dir = f.Dir
+	cmd.Env = append(os.Environ(), "FILE="+name)
+	cmd.Stdout = f.Stdout
+	cmd.Stderr = f.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		<-f.sem
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		<-f.sem
+		return nil, err
+	}
+
+	return &filterPart{cmd: cmd, stdin: stdin, release: func() { <-f.sem }}, nil
+}
+
+// Abort は何もしない
+// コマンドに渡した内容は取り消せないので、書き込みに失敗した場合の後始末はコマンド側に任せる
+func (f *FilterSink) Abort(name string) error { return nil }
+
+type filterPart struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	release func()
+	closed  bool
+}
+
+// Write はコマンドの標準入力に書き込む
+// コマンドが入力を最後まで読まずに終了した場合(例: head -1)は、残りを捨ててエラーにしない
+func (p *filterPart) Write(b []byte) (int, error) {
+	n, err := p.stdin.Write(b)
+	if errors.Is(err, syscall.EPIPE) {
+		return len(b), nil
+	}
+	return n, err
+}
+
+func (p *filterPart) Close() error {
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	defer p.release()
+
+	// 標準入力を閉じてからコマンドの終了を待つ
+	if err := p.stdin.Close(); err != nil && !errors.Is(err, syscall.EPIPE) {
+		_ = p.cmd.Wait()
+		return err
+	}
+	if err := p.cmd.Wait(); err != nil {
+		return fmt.Errorf("filter %q: %w", p.cmd.Args[len(p.cmd.Args)-1], err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package splitter
+
+// 入力をランダムアクセス可能な *io.SectionReader として扱うための関数群
+// chunk 単位の分割では各 chunk の範囲を入力のサイズから事前に計算できるので、入力全体をメモリに読み込まずに済む
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// sizer は io.SectionReader, strings.Reader, bytes.Reader のようにサイズが分かっている入力
+type sizer interface {
+	Size() int64
+}
+
+// sectionOf は input がランダムアクセス可能な場合、現在の読み込み位置から終端までの *io.SectionReader を返す
+// *os.File は通常ファイルの場合のみ Stat().Size() を使ってサイズを求める
+func sectionOf(input io.Reader) (*io.SectionReader, bool) {
+	readerAt, ok := input.(io.ReaderAt)
+	if !ok {
+		return nil, false
+	}
+	seeker, ok := input.(io.Seeker)
+	if !ok {
+		return nil, false
+	}
+
+	var size int64
+	switch in := input.(type) {
+	case *os.File:
+		info, err := in.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return nil, false
+		}
+		size = info.Size()
+	case sizer:
+		size = in.Size()
+	default:
+		return nil, false
+	}
+
+	pos, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil || pos > size {
+		return nil, false
+	}
+
+	return io.NewSectionReader(readerAt, pos, size-pos), true
+}
+
+// openSection は input を *io.SectionReader として返す
+// 標準入力のようにランダムアクセスできない入力は一時ファイルに書き出し(spill)、そのファイルを返す
+// 戻り値の cleanup で一時ファイルを削除する
+func openSection(input io.Reader) (section *io.SectionReader, cleanup func(), err error) {
+	if section, ok := sectionOf(input); ok {
+		return section, func() {}, nil
+	}
+
+	tmp, err := os.CreateTemp("", "split-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("openSection(): %w", err)
+	}
+	cleanup = func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}
+
+	size, err := io.Copy(tmp, input)
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("openSection(): %w", err)
+	}
+
+	return io.NewSectionReader(tmp, 0, size), cleanup, nil
+}
@@ -0,0 +1,154 @@
+package splitter
+
+// 分割したパートを元の順番に連結する処理
+// パートの名前は分割した時と同じ Splitter の設定(prefix, suffix, AdditionalSuffix, NameTemplate)から順番に組み立てるので、
+// "yz" の次が "zaaa" になるような suffix の自動拡張や、数字の suffix、テンプレートで組み立てた名前でも正しい順番に並べられる
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrNoParts     = errors.New("パートが見つかりません")
+	ErrMissingPart = errors.New("パートが欠けています")
+)
+
+// FindParts は dir にあるパートを、分割した時の順番に並べて返す
+// 途中のパートが欠けている場合は、欠けているパートの名前と ErrMissingPart をラップしたエラーを返す
+// NameTemplate が {total} を使う場合は、最初のパートの名前からパートの総数を求め、最後のパートまで揃っているかも確認する
+func (s *Splitter) FindParts(dir string) ([]string, error) {
+	exists, err := readEntries(dir)
+	if err != nil {
+		return nil, fmt.Errorf("FindParts(): %w", err)
+	}
+	names, err := s.walkPartNames(exists, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var parts, missing []string
+	for _, name := range names {
+		if exists[name] {
+			parts = append(parts, name)
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	if len(parts) == 0 {
+		return nil, ErrNoParts
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%s: %w", strings.Join(missing, ", "), ErrMissingPart)
+	}
+	return parts, nil
+}
+
+// readEntries は dir にあるファイルの名前の集合を返す
+func readEntries(dir string) (map[string]bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			exists[entry.Name()] = true
+		}
+	}
+	return exists, nil
+}
+
+// walkPartNames は分割した時の順番にパートの名前を組み立て、exists に存在するか、want が true を返す最後の名前までを返す
+// 途中の名前には exists に存在しないものも含まれるので、呼び出し元はそれを欠けているパートとして扱う
+// 見つからない名前が exists のエントリ数より多く続いた所で、それ以上先を探しても見つからないので探すのをやめる
+// NameTemplate が {total} を使う場合は、最初のパートの名前から求めたパートの総数までの名前を全て返す
+// want が nil の場合は exists に存在する名前だけを探す
+func (s *Splitter) walkPartNames(exists map[string]bool, want func(name string) bool) ([]string, error) {
+	if err := s.validateSuffix(); err != nil {
+		return nil, err
+	}
+	found := func(name string) bool {
+		return exists[name] || (want != nil && want(name))
+	}
+
+	total := unknownTotal
+	if s.NameTemplate != nil && s.NameTemplate.usesTotal {
+		if total = s.findTotal(found); total == unknownTotal {
+			return nil, nil
+		}
+	}
+
+	var names []string
+	last := -1 // 最後に見つかった名前の位置
+	outputSuffix := s.firstSuffix()
+	for index := 0; !s.suffixExhausted(outputSuffix); index++ {
+		if total != unknownTotal && index >= total {
+			break
+		}
+
+		name := s.partName(index, outputSuffix, total)
+		names = append(names, name)
+		if found(name) {
+			last = index
+		} else if total == unknownTotal && index-last > len(exists) {
+			break
+		}
+		outputSuffix = s.nextSuffix(outputSuffix)
+	}
+
+	if total == unknownTotal {
+		return names[:last+1], nil
+	}
+	return names, nil
+}
+
+// maxJoinTotal は {total} を使う NameTemplate で、パートの総数として探す上限
+// パートが欠けている場合もあるので、dir のエントリ数より大きい総数も探す
+const maxJoinTotal = 1 << 16
+
+// findTotal は {total} を使う NameTemplate で、最初のパートの名前が見つかるようなパートの総数を返す
+// 見つからない場合は unknownTotal を返す
+func (s *Splitter) findTotal(found func(name string) bool) int {
+	first := s.firstSuffix()
+	for total := 1; total <= maxJoinTotal; total++ {
+		if found(s.partName(0, first, total)) {
+			return total
+		}
+	}
+	return unknownTotal
+}
+
+// Join は dir にある parts を順番に連結して w に書き出す
+// parts には FindParts で見つけたパートを渡す
+func (s *Splitter) Join(ctx context.Context, dir string, parts []string, w io.Writer) error {
+	buf := make([]byte, 64*1024)
+	var offset int64
+	for _, name := range parts {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := joinPart(filepath.Join(dir, name), w, buf)
+		if err != nil {
+			return &PartError{Op: "read", Part: name, Offset: offset + n, Err: err}
+		}
+		offset += n
+	}
+	return nil
+}
+
+func joinPart(path string, w io.Writer, buf []byte) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return io.CopyBuffer(w, f, buf)
+}
@@ -0,0 +1,351 @@
+package splitter
+
+// --manifest で書き出す、分割の結果を記録したファイル
+// パートを閉じるたびにその名前、入力中の位置、バイト数、行数、SHA-256 を記録し、一定の間隔で JSON として書き出し直す
+// 分割が終わった時は失敗した場合も書き出すので、それまでに閉じたパートの記録が残る
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ntk221/split/option"
+)
+
+// Manifest は分割の結果を記録したもの
+type Manifest struct {
+	Input     string     `json:"input"`     // 入力ファイルの名前。標準入力の場合は "-"、チェックサムファイルから読み込んだ場合は空文字列
+	Size      int64      `json:"size"`      // 入力のバイト数。分割が終わっていない場合はそれまでに読み込んだバイト数
+	Mode      string     `json:"mode"`      // 分割方法 (lines, bytes, line-bytes, chunks, pattern, csplit)
+	Parameter string     `json:"parameter"` // 分割方法に指定した値 (例: "1000", "l/4")
+	Complete  bool       `json:"complete"`  // 分割が最後まで成功したか否か
+	Parts     []PartInfo `json:"parts"`     // 作成したパートを分割した順番に並べたもの
+}
+
+// PartInfo は作成したパート1つ分の記録
+// -n r/N ではパートの内容が入力の連続した範囲ではないので、Offset は 0 になる
+// チェックサムファイルから読み込んだ場合は、Length と Lines は記録されていないので unknownLength になる
+type PartInfo struct {
+	Index  int    `json:"index"`
+	Name   string `json:"name"`
+	Offset int64  `json:"offset"` // パートの先頭が入力の何バイト目にあたるか
+	Length int64  `json:"length"`
+	Lines  int64  `json:"lines"` // 区切り文字で区切られた行の数。最後の行が区切り文字で終わっていなくても1行と数える
+	SHA256 string `json:"sha256"`
+}
+
+// unknownLength はチェックサムファイルにパートのバイト数が記録されていないことを表す
+const unknownLength = -1
+
+var ErrInvalidChecksum = errors.New("チェックサムファイルの形式が不正です")
+
+// ReadManifest は path に書き出された Manifest を読み込む
+// path が JSON でない場合は、sha256sum が出力する形式のチェックサムファイルとして読み込む
+// ex: "16fbd7d1...  xaa"
+func ReadManifest(path string) (*Manifest, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ReadManifest(): %w", err)
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+		return parseChecksums(path, b)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("ReadManifest(): %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// parseChecksums はチェックサムファイルの各行を、その順番に並べたパートの記録として返す
+// 空行と "#" で始まる行は読み飛ばす
+func parseChecksums(path string, b []byte) (*Manifest, error) {
+	m := &Manifest{Size: unknownLength}
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// "<hex>  name" (テキストモード) と "<hex> *name" (バイナリモード) のどちらも受け付ける
+		sum, name, ok := strings.Cut(line, " ")
+		name = strings.TrimPrefix(strings.TrimPrefix(name, " "), "*")
+		if _, err := hex.DecodeString(sum); !ok || err != nil || len(sum) != sha256.Size*2 || name == "" {
+			return nil, fmt.Errorf("ReadManifest(): %s:%d: %w", path, i+1, ErrInvalidChecksum)
+		}
+		m.Parts = append(m.Parts, PartInfo{
+			Index:  len(m.Parts),
+			Name:   name,
+			Length: unknownLength,
+			Lines:  unknownLength,
+			SHA256: strings.ToLower(sum),
+		})
+	}
+	if len(m.Parts) == 0 {
+		return nil, fmt.Errorf("ReadManifest(): %s: %w", path, ErrInvalidChecksum)
+	}
+	return m, nil
+}
+
+// newManifest は分割を始める前の、パートを1つも記録していない Manifest を返す
+func (s *Splitter) newManifest(opt option.Command) Manifest {
+	input := s.InputName
+	if input == "" {
+		input = "-"
+	}
+	mode, parameter := describeOption(opt)
+	return Manifest{Input: input, Mode: mode, Parameter: parameter}
+}
+
+// describeOption は Manifest に記録する分割方法と、それに指定した値を返す
+func describeOption(opt option.Command) (mode string, parameter string) {
+	switch o := opt.(type) {
+	case option.LineCount:
+		return "lines", strconv.Itoa(int(o))
+	case option.ByteCount:
+		return "bytes", strconv.Itoa(int(o))
+	case option.LineBytes:
+		return "line-bytes", strconv.Itoa(int(o))
+	case option.ChunkCount:
+		return "chunks", strconv.Itoa(int(o))
+	case option.LineChunkCount:
+		return "chunks", "l/" + strconv.Itoa(int(o))
+	case option.RoundRobin:
+		return "chunks", "r/" + strconv.Itoa(int(o))
+	case option.ExtractChunk:
+		prefix := map[option.ChunkKind]string{option.ByteChunk: "", option.LineChunk: "l/", option.RoundRobinChunk: "r/"}[o.Kind]
+		return "chunks", fmt.Sprintf("%s%d/%d", prefix, o.Index, o.Count)
+	case option.Pattern:
+		return "pattern", o.Regexp.String()
+	case option.CsplitPatterns:
+		return "csplit", o.String()
+	}
+	return fmt.Sprintf("%T", opt), ""
+}
+
+// measureInput は分割が終わった時に入力のバイト数を返す関数と、input の代わりに読み込む io.Reader を返す
+// ランダムアクセス可能な入力はサイズが分かるので、input をそのまま返す
+func measureInput(input io.Reader) (io.Reader, func() int64) {
+	if section, ok := sectionOf(input); ok {
+		size := section.Size()
+		return input, func() int64 { return size }
+	}
+
+	var count int64
+	return &countingReader{r: input, count: &count}, func() int64 { return atomic.LoadInt64(&count) }
+}
+
+// manifestInterval は分割の途中で Manifest を書き出し直す最短の間隔
+// パートを閉じるたびに書き出すと、パートの数の2乗に比例して時間がかかるため間引く
+const manifestInterval = time.Second
+
+// recordSink は作成したパートの内容を記録する OutputSink
+// 分割の途中では manifestInterval ごとに、記録したパートを path に Manifest として書き出し直す
+// パートの入力中の位置を記録するために、createPart は Create の代わりに createAt を呼び出す
+type recordSink struct {
+	OutputSink
+	sep      []byte
+	path     string
+	manifest Manifest
+	size     func() int64
+
+	mu        sync.Mutex
+	parts     []partRecord   // Index の順番に並べた記録
+	indexes   map[string]int // パートの名前から Index を引く
+	lastWrite time.Time
+}
+
+// partRecord はパート1つ分の記録
+// 破棄したパートは記録から詰めずに aborted にしておき、書き出す時に除く
+type partRecord struct {
+	PartInfo
+	aborted bool
+}
+
+func newRecordSink(sink OutputSink, sep string, path string, manifest Manifest, size func() int64) *recordSink {
+	return &recordSink{
+		OutputSink: sink,
+		sep:        []byte(sep),
+		path:       path,
+		manifest:   manifest,
+		size:       size,
+		indexes:    make(map[string]int),
+	}
+}
+
+func (r *recordSink) Create(index int, name string) (io.WriteCloser, error) {
+	return r.createAt(index, name, 0)
+}
+
+func (r *recordSink) createAt(index int, name string, offset int64) (io.WriteCloser, error) {
+	w, err := r.OutputSink.Create(index, name)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingPart{
+		WriteCloser: w,
+		sink:        r,
+		info:        PartInfo{Index: index, Name: name, Offset: offset},
+		hash:        sha256.New(),
+	}, nil
+}
+
+// Abort は破棄したパートを記録から取り除く
+func (r *recordSink) Abort(name string) error {
+	r.mu.Lock()
+	if index, ok := r.indexes[name]; ok {
+		if pos := r.search(index); pos < len(r.parts) && r.parts[pos].Name == name {
+			r.parts[pos].aborted = true
+		}
+		delete(r.indexes, name)
+	}
+	r.mu.Unlock()
+
+	return r.OutputSink.Abort(name)
+}
+
+// search は Index が index 以上になる最初の記録の位置を返す
+// 事前条件: r.mu をロックしている
+func (r *recordSink) search(index int) int {
+	return sort.Search(len(r.parts), func(i int) bool { return r.parts[i].Index >= index })
+}
+
+func (r *recordSink) record(info PartInfo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// パートはほとんどの場合 Index の順番に閉じるので、末尾に追加するだけで済む
+	// 並列に書き出す場合や、破棄したパートと同じ Index で作り直した場合は途中に入れる
+	pos := r.search(info.Index)
+	switch {
+	case pos == len(r.parts):
+		r.parts = append(r.parts, partRecord{PartInfo: info})
+	case r.parts[pos].Index == info.Index:
+		r.parts[pos] = partRecord{PartInfo: info}
+	default:
+		r.parts = append(r.parts, partRecord{})
+		copy(r.parts[pos+1:], r.parts[pos:])
+		r.parts[pos] = partRecord{PartInfo: info}
+	}
+	r.indexes[info.Name] = info.Index
+
+	if time.Since(r.lastWrite) < manifestInterval {
+		return nil
+	}
+	return r.write(false)
+}
+
+// save は記録したパートを Manifest として書き出す
+// complete には分割が最後まで成功したか否かを渡す
+func (r *recordSink) save(complete bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.write(complete)
+}
+
+// write は記録したパートを Manifest として path に書き出す
+// 書き出している途中で中断しても壊れた Manifest が残らないように、一時ファイルに書き出してから置き換える
+// 事前条件: r.mu をロックしている
+func (r *recordSink) write(complete bool) error {
+	r.lastWrite = time.Now()
+
+	m := r.manifest
+	m.Size = r.size()
+	m.Complete = complete
+	m.Parts = make([]PartInfo, 0, len(r.parts))
+	for _, record := range r.parts {
+		if !record.aborted {
+			m.Parts = append(m.Parts, record.PartInfo)
+		}
+	}
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("writeManifest(): %w", err)
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		return fmt.Errorf("writeManifest(): %w", err)
+	}
+	if err := os.Rename(tmp, r.path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("writeManifest(): %w", err)
+	}
+	return nil
+}
+
+// recordingPart は書き込んだ内容の SHA-256 と行数を数えながら、パートに書き込む
+type recordingPart struct {
+	io.WriteCloser
+	sink *recordSink
+	info PartInfo
+	hash hash.Hash
+
+	last []byte // これまでに書き込んだ内容の末尾 len(sep) バイト
+}
+
+func (p *recordingPart) Write(b []byte) (int, error) {
+	n, err := p.WriteCloser.Write(b)
+	written := b[:n]
+	p.hash.Write(written)
+	p.info.Length += int64(n)
+	p.countLines(written)
+	return n, err
+}
+
+// countLines は written に含まれる区切り文字の数を数える
+// 区切り文字が複数バイトの場合は、前回までに書き込んだ末尾とまたがっているものも数える
+func (p *recordingPart) countLines(written []byte) {
+	sep := p.sink.sep
+	p.info.Lines += int64(bytes.Count(written, sep))
+
+	if keep := len(sep) - 1; keep > 0 {
+		prev := p.last
+		if len(prev) > keep {
+			prev = prev[len(prev)-keep:]
+		}
+		head := written
+		if len(head) > keep {
+			head = head[:keep]
+		}
+		straddle := append(append([]byte(nil), prev...), head...)
+		p.info.Lines += int64(bytes.Count(straddle, sep))
+	}
+
+	if len(written) >= len(sep) {
+		p.last = append(p.last[:0], written[len(written)-len(sep):]...)
+		return
+	}
+	p.last = append(p.last, written...)
+	if len(p.last) > len(sep) {
+		p.last = append(p.last[:0], p.last[len(p.last)-len(sep):]...)
+	}
+}
+
+func (p *recordingPart) Close() error {
+	if err := p.WriteCloser.Close(); err != nil {
+		return err
+	}
+
+	// 最後の行が区切り文字で終わっていない場合も1行と数える
+	info := p.info
+	if info.Length > 0 && !bytes.Equal(p.last, p.sink.sep) {
+		info.Lines++
+	}
+	info.SHA256 = hex.EncodeToString(p.hash.Sum(nil))
+	return p.sink.record(info)
+}
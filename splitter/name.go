@@ -0,0 +1,178 @@
+package splitter
+
+// パートの名前を組み立てるテンプレート
+// --name-template に "{prefix}-{index:04d}-of-{total}{ext}" のように指定する
+//
+// 使えるプレースホルダは以下の通り
+//
+//	{prefix}   出力ファイル名の prefix
+//	{suffix}   SuffixGenerator で生成した suffix
+//	{index}    パートの番号(1始まり)。{index:04d} のように幅を指定できる
+//	{total}    パートの総数。-n のように総数が分割前に決まる場合のみ使える(-e と -n r/N を合わせた場合は使えない)
+//	{basename} 入力ファイル名からディレクトリと拡張子を除いたもの
+//	{ext}      入力ファイル名の拡張子 (例: ".log")
+//
+// 全てのパートが同じ名前にならないように、{suffix} か {index} のどちらかを含んでいなければならない
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// unknownTotal はパートの総数が分割前に決まらないことを表す
+const unknownTotal = -1
+
+var (
+	ErrInvalidTemplate = errors.New("name templateの指定が不正です")
+	ErrCollidingNames  = errors.New("name templateには{suffix}か{index}が必要です")
+	ErrUnknownTotal    = errors.New("この分割方法では{total}を使えません")
+)
+
+// NameTemplate はパートの名前を組み立てるテンプレート
+type NameTemplate struct {
+	segments  []templateSegment
+	usesTotal bool
+}
+
+// templateSegment はテンプレートを区切ったもの
+// placeholder が空の場合は text をそのまま使う
+type templateSegment struct {
+	text        string
+	placeholder string
+	format      string
+}
+
+// nameValues はテンプレートに埋め込む値
+type nameValues struct {
+	prefix   string
+	suffix   string
+	index    int
+	total    int
+	basename string
+	ext      string
+}
+
+var (
+	placeholderPattern = regexp.MustCompile(`\{([a-z]+)(?::(0?[0-9]*d))?\}`)
+	numberPlaceholders = map[string]bool{"index": true, "total": true}
+	textPlaceholders   = map[string]bool{"prefix": true, "suffix": true, "basename": true, "ext": true}
+)
+
+// ParseNameTemplate は --name-template に指定された文字列を解釈する
+// 未知のプレースホルダや、パートの名前が衝突しうるテンプレートはエラーにする
+func ParseNameTemplate(s string) (*NameTemplate, error) {
+	t := &NameTemplate{}
+	unique := false
+
+	rest := s
+	for rest != "" {
+		loc := placeholderPattern.FindStringSubmatchIndex(rest)
+		if loc == nil {
+			t.segments = append(t.segments, templateSegment{text: rest})
+			break
+		}
+		if loc[0] > 0 {
+			t.segments = append(t.segments, templateSegment{text: rest[:loc[0]]})
+		}
+
+		name := rest[loc[2]:loc[3]]
+		format := ""
+		if loc[4] >= 0 {
+			format = rest[loc[4]:loc[5]]
+		}
+		switch {
+		case numberPlaceholders[name]:
+		case textPlaceholders[name] && format == "":
+		default:
+			return nil, fmt.Errorf("%s: %s: %w", s, rest[loc[0]:loc[1]], ErrInvalidTemplate)
+		}
+
+		t.segments = append(t.segments, templateSegment{placeholder: name, format: format})
+		if name == "suffix" || name == "index" {
+			unique = true
+		}
+		if name == "total" {
+			t.usesTotal = true
+		}
+		rest = rest[loc[1]:]
+	}
+
+	for _, seg := range t.segments {
+		if strings.ContainsAny(seg.text, "{}/") {
+			return nil, fmt.Errorf("%s: %w", s, ErrInvalidTemplate)
+		}
+	}
+	if !unique {
+		return nil, fmt.Errorf("%s: %w", s, ErrCollidingNames)
+	}
+
+	return t, nil
+}
+
+// execute は v をテンプレートに埋め込んだ名前を返す
+func (t *NameTemplate) execute(v nameValues) string {
+	var b strings.Builder
+	for _, seg := range t.segments {
+		switch seg.placeholder {
+		case "":
+			b.WriteString(seg.text)
+		case "prefix":
+			b.WriteString(v.prefix)
+		case "suffix":
+			b.WriteString(v.suffix)
+		case "basename":
+			b.WriteString(v.basename)
+		case "ext":
+			b.WriteString(v.ext)
+		case "index":
+			b.WriteString(formatNumber(v.index+1, seg.format))
+		case "total":
+			b.WriteString(formatNumber(v.total, seg.format))
+		}
+	}
+	return b.String()
+}
+
+func formatNumber(n int, format string) string {
+	if format == "" {
+		format = "d"
+	}
+	return fmt.Sprintf("%"+format, n)
+}
+
+// partName は index 番目(0始まり)のパートの名前を返す
+// NameTemplate が指定されていない場合は prefix + suffix + AdditionalSuffix、指定されている場合はテンプレート + AdditionalSuffix になる
+// ex: prefix が "x"、AdditionalSuffix が ".csv" の場合、partName(0, "aa", unknownTotal) == "xaa.csv"
+// total はパートの総数で、分割前に決まらない場合は unknownTotal を渡す
+func (s *Splitter) partName(index int, suffix string, total int) string {
+	if s.NameTemplate == nil {
+		return s.outputPrefix + suffix + s.AdditionalSuffix
+	}
+
+	base := ""
+	if s.InputName != "" {
+		base = filepath.Base(s.InputName)
+	}
+	ext := filepath.Ext(base)
+	name := s.NameTemplate.execute(nameValues{
+		prefix:   s.outputPrefix,
+		suffix:   suffix,
+		index:    index,
+		total:    total,
+		basename: strings.TrimSuffix(base, ext),
+		ext:      ext,
+	})
+	return name + s.AdditionalSuffix
+}
+
+// validateNameTemplate は NameTemplate が分割方法に対して使えるかを確認する
+// {total} は分割前にパートの総数が決まる場合のみ使える
+func (s *Splitter) validateNameTemplate(totalKnown bool) error {
+	if s.NameTemplate == nil || !s.NameTemplate.usesTotal || totalKnown {
+		return nil
+	}
+	return ErrUnknownTotal
+}
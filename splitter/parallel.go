@@ -0,0 +1,140 @@
+package splitter
+
+// 入力がランダムアクセス可能で、各パートの範囲が事前に分かっている場合にパートを並列に書き出す処理
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// PartErrors は並列書き込み時に複数のパートで発生したエラーをパートの順番に並べたもの
+type PartErrors []error
+
+func (e PartErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is はいずれかのエラーが target に該当するかを返す
+func (e PartErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As は target に該当する最初のエラーを target に設定する
+func (e PartErrors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// partRange は書き出すパートと、そのパートに書き込む入力の範囲
+type partRange struct {
+	index   int
+	name    string
+	offset  int64
+	section *io.SectionReader
+}
+
+// nameRanges は ranges の各パートに先頭から順番に番号と名前を割り当てる
+// 空のパートを省いた後に割り当てるので、パートの名前は連番になり、{total} は実際に作成するパートの数になる
+func (s *Splitter) nameRanges(ranges []partRange) error {
+	outputSuffix := s.firstSuffix()
+	for i := range ranges {
+		if s.suffixExhausted(outputSuffix) {
+			return ErrTooManyFile
+		}
+		ranges[i].index = i
+		ranges[i].name = s.partName(i, outputSuffix, len(ranges))
+		outputSuffix = s.nextSuffix(outputSuffix)
+	}
+	return nil
+}
+
+// writeParts は ranges の各パートを sink に書き出す
+// workers が 2 以上の場合は workers 個の goroutine で並列に書き出す
+// 各 worker は自分の担当する範囲だけを ReadAt で読み込むので、書き出されるパートの内容は workers の数によらない
+func writeParts(ctx context.Context, sink OutputSink, ranges []partRange, workers int, bufSize uint64) error {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(ranges) {
+		workers = len(ranges)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// errs[i] は ranges[i] の書き出し時に発生したエラー
+	errs := make([]error, len(ranges))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, bufSize)
+			for i := range jobs {
+				// 他のパートでエラーが発生した場合は残りのパートを書き出さない
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := writePart(sink, ranges[i], buf); err != nil {
+					errs[i] = err
+					cancel()
+				}
+			}
+		}()
+	}
+
+	for i := range ranges {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var partErrs PartErrors
+	for _, err := range errs {
+		if err != nil {
+			partErrs = append(partErrs, err)
+		}
+	}
+
+	switch len(partErrs) {
+	case 0:
+		// 呼び出し元の ctx がキャンセルされた場合
+		return ctx.Err()
+	case 1:
+		return partErrs[0]
+	default:
+		return partErrs
+	}
+}
+
+func writePart(sink OutputSink, r partRange, buf []byte) error {
+	outputFile, perr := createPart(sink, r.index, r.name, r.offset)
+	if perr != nil {
+		return perr
+	}
+
+	if err := copyPart(outputFile, r.section, buf); err != nil {
+		outputFile.abort(sink)
+		return err
+	}
+
+	return outputFile.Close()
+}
@@ -0,0 +1,153 @@
+package splitter
+
+// 分割の進み具合を Splitter.OnProgress に通知する処理
+// 入力を読み込んだバイト数を数える reader で入力を包み、ProgressInterval ごとに Progress を通知する
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultProgressInterval は ProgressInterval が指定されていない場合に進み具合を通知する間隔
+const DefaultProgressInterval = 500 * time.Millisecond
+
+// Progress は分割の進み具合
+type Progress struct {
+	BytesRead  int64 // 入力から読み込んだバイト数
+	TotalBytes int64 // 入力のバイト数。標準入力のパイプなどで分からない場合は -1
+	Parts      int   // 作成したパートの数
+	Elapsed    time.Duration
+	Done       bool // 分割が終わった(エラーで中断した場合も含む)時の最後の通知であるか
+}
+
+// Throughput は1秒あたりに読み込んだバイト数を返す
+func (p Progress) Throughput() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.BytesRead) / p.Elapsed.Seconds()
+}
+
+// ETA は残りの入力を読み込むのにかかる時間の見積もりを返す
+// 入力のバイト数が分からない場合や、まだ何も読み込んでいない場合は false を返す
+func (p Progress) ETA() (time.Duration, bool) {
+	throughput := p.Throughput()
+	if p.TotalBytes < 0 || throughput == 0 {
+		return 0, false
+	}
+	remaining := p.TotalBytes - p.BytesRead
+	if remaining < 0 {
+		remaining = 0
+	}
+	return time.Duration(float64(remaining) / throughput * float64(time.Second)), true
+}
+
+// progressTracker は読み込んだバイト数と作成したパートの数を数え、定期的に通知する
+type progressTracker struct {
+	bytesRead int64 // atomic に読み書きする
+	parts     int64 // atomic に読み書きする
+	total     int64
+	start     time.Time
+
+	onProgress func(Progress)
+	stop       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// trackProgress は input を読み込んだバイト数を数える reader と、通知を始めた progressTracker を返す
+// input がランダムアクセス可能な場合は、返す reader もランダムアクセス可能にして入力のサイズを TotalBytes にする
+func trackProgress(input io.Reader, onProgress func(Progress), interval time.Duration) (io.Reader, *progressTracker) {
+	t := &progressTracker{total: -1, start: time.Now(), onProgress: onProgress, stop: make(chan struct{})}
+
+	var counted io.Reader = &countingReader{r: input, count: &t.bytesRead}
+	if section, ok := sectionOf(input); ok {
+		t.total = section.Size()
+		counted = &countingSection{section: section, count: &t.bytesRead}
+	}
+
+	if interval <= 0 {
+		interval = DefaultProgressInterval
+	}
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.onProgress(t.progress(false))
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+
+	return counted, t
+}
+
+// partCreated は notifySink から呼び出され、作成したパートの数を数える
+func (t *progressTracker) partCreated(index int, name string) {
+	atomic.AddInt64(&t.parts, 1)
+}
+
+// finish は定期的な通知を止めて、最後の通知をする
+func (t *progressTracker) finish() {
+	close(t.stop)
+	t.wg.Wait()
+	t.onProgress(t.progress(true))
+}
+
+func (t *progressTracker) progress(done bool) Progress {
+	read := atomic.LoadInt64(&t.bytesRead)
+	// -n l/N では chunk の境界を探すために同じ範囲を読み込むことがあるので、入力のサイズを超えないようにする
+	if t.total >= 0 && read > t.total {
+		read = t.total
+	}
+	return Progress{
+		BytesRead:  read,
+		TotalBytes: t.total,
+		Parts:      int(atomic.LoadInt64(&t.parts)),
+		Elapsed:    time.Since(t.start),
+		Done:       done,
+	}
+}
+
+// countingReader は読み込んだバイト数を count に加える io.Reader
+type countingReader struct {
+	r     io.Reader
+	count *int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	atomic.AddInt64(c.count, int64(n))
+	return n, err
+}
+
+// countingSection は countingReader のランダムアクセス可能な版
+// sectionOf がランダムアクセス可能な入力として扱えるように、io.ReaderAt, io.Seeker と Size を実装する
+type countingSection struct {
+	section *io.SectionReader
+	count   *int64
+}
+
+func (c *countingSection) Read(b []byte) (int, error) {
+	n, err := c.section.Read(b)
+	atomic.AddInt64(c.count, int64(n))
+	return n, err
+}
+
+func (c *countingSection) ReadAt(b []byte, off int64) (int, error) {
+	n, err := c.section.ReadAt(b, off)
+	atomic.AddInt64(c.count, int64(n))
+	return n, err
+}
+
+func (c *countingSection) Seek(offset int64, whence int) (int64, error) {
+	return c.section.Seek(offset, whence)
+}
+
+func (c *countingSection) Size() int64 { return c.section.Size() }
@@ -4,27 +4,82 @@ package splitter
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
-	"github.com/ntk221/split/option"
 	"io"
-	"log"
-	"os"
 )
 
-func readLines(lineCount uint64, reader *bufio.Reader) ([]string, error) {
+// DefaultSeparator は Splitter.Separator が指定されていない場合の行の区切り
+const DefaultSeparator = "\n"
+
+func (s *Splitter) separator() string {
+	if s.Separator == "" {
+		return DefaultSeparator
+	}
+	return s.Separator
+}
+
+// recordReader は区切り文字 sep で区切られたレコード(行)を読み込む *bufio.Reader
+// sep は複数バイトでもよい
+type recordReader struct {
+	*bufio.Reader
+	sep  []byte
+	tail []byte // 区切り文字が ReadSlice の境界をまたぐ場合に備えて、直前に読み込んだ末尾を残しておく
+}
+
+func newRecordReader(r io.Reader, sep string) *recordReader {
+	return &recordReader{Reader: bufio.NewReader(r), sep: []byte(sep)}
+}
+
+// readSlice は bufio.Reader.ReadSlice と同様に、次の区切り文字までを読み込む
+// レコードが bufio.Reader のバッファより長い場合は、途中までを返して bufio.ErrBufferFull を返す
+func (r *recordReader) readSlice() ([]byte, error) {
+	chunk, err := r.Reader.ReadSlice(r.sep[len(r.sep)-1])
+	if len(r.sep) == 1 {
+		return chunk, err
+	}
+
+	r.tail = append(r.tail, chunk...)
+	complete := err == nil && bytes.HasSuffix(r.tail, r.sep)
+	if keep := len(r.sep) - 1; len(r.tail) > keep {
+		r.tail = append(r.tail[:0], r.tail[len(r.tail)-keep:]...)
+	}
+	if complete {
+		r.tail = r.tail[:0]
+	} else if err == nil {
+		// 区切り文字の最後のバイトだけが現れた場合は、レコードの途中である
+		err = bufio.ErrBufferFull
+	}
+	return chunk, err
+}
+
+// readString は区切り文字までの1レコードを読み込む
+// 終端に達した場合は、それまでに読み込めたバイト列と io.EOF を返す
+func (r *recordReader) readString() (string, error) {
+	var record []byte
+	for {
+		chunk, err := r.readSlice()
+		record = append(record, chunk...)
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return string(record), err
+		}
+	}
+}
+
+// readLines は reader から lineCount 行読み込む
+// 終端に達した場合は、それまでに読み込めた行と io.EOF をラップしたエラーを返す
+func readLines(lineCount uint64, reader *recordReader) ([]string, error) {
 	var lines []string
 
 	var i uint64
 	for i = 0; i < lineCount; i++ {
-		line, err := reader.ReadString('\n')
+		line, err := reader.readString()
 		if err != nil {
 			if len(line) > 0 {
 				lines = append(lines, line)
 			}
-			if err == io.EOF {
-				return lines, fmt.Errorf("readLines(): %w", err)
-			}
-			log.Fatalf("readLines()で読み込みに失敗しました: %v", err)
+			return lines, fmt.Errorf("readLines(): %w", err)
 		}
 		lines = append(lines, line)
 	}
@@ -32,84 +87,189 @@ func readLines(lineCount uint64, reader *bufio.Reader) ([]string, error) {
 	return lines, nil
 }
 
-func readChunk(index uint64, chunkSize uint64, chunkCount uint64, content []byte) ([]byte, bool) {
+// readLineAtMost は reader から1行を読み込む
+// 行が max バイトより長い場合は先頭の max バイトだけを読み込み、残りは reader に残しておく
+// 終端に達した場合は、それまでに読み込めたバイト列と io.EOF を返す
+func readLineAtMost(reader *recordReader, max int) ([]byte, error) {
+	var line []byte
+	for len(line) < max {
+		n := max - len(line)
+		if n > reader.Size() {
+			n = reader.Size()
+		}
+
+		buf, err := reader.Peek(n)
+		// 区切り文字が前回 Peek した部分とまたがっていても見つけられるように、line の末尾から探す
+		read := len(line)
+		from := read - (len(reader.sep) - 1)
+		if from < 0 {
+			from = 0
+		}
+		line = append(line, buf...)
+		if i := bytes.Index(line[from:], reader.sep); i >= 0 {
+			end := from + i + len(reader.sep)
+			_, _ = reader.Discard(end - read)
+			return line[:end], nil
+		}
+		_, _ = reader.Discard(len(buf))
+		if err != nil {
+			return line, err
+		}
+	}
+
+	return line, nil
+}
+
+// readChunk は content を chunkCount 個に分割した時の index 番目の chunk と、その先頭の位置を返す
+// content 全体を読み込まずに、chunk の範囲だけを指す *io.SectionReader を返す
+// chunkCount が content のバイト数より大きい場合、後ろの chunk は空になる
+func readChunk(index uint64, chunkSize uint64, chunkCount uint64, content *io.SectionReader) (*io.SectionReader, int64) {
+	size := uint64(content.Size())
 	// index番目のchunkを特定する
 	start := index * chunkSize
 	end := start + chunkSize
 	// index が n-1番目の時(最後のchunk1の時)はendをcontentの終端に揃える(manを参照)
 	if index == chunkCount-1 {
-		end = uint64(len(content))
+		end = size
+	}
+	if start > size {
+		start = size
 	}
-	chunk := content[start:end]
-	// i番目のchunkがすでに空の時は終了する
-	if !(len(chunk) > 0) {
-		return nil, false
+	if end > size {
+		end = size
 	}
 
-	return chunk, true
+	return io.NewSectionReader(content, int64(start), int64(end-start)), int64(start)
 }
 
-func readBytes(byteCountOption option.ByteCount, reader *bufio.Reader, outputFile *os.File) ([]byte, error) {
-	// 読み込んだ合計バイト数
-	var readBytes uint64
+// chunkSizeOf は size バイトの content を chunkCount 個に分割した時の、1つの chunk のバイト数を返す
+// chunkCount が size より大きい場合は、先頭の chunk から1バイトずつ割り当てる
+func chunkSizeOf(size int64, chunkCount uint64) uint64 {
+	chunkSize := uint64(size) / chunkCount
+	if chunkSize == 0 {
+		return 1
+	}
+	return chunkSize
+}
 
-	byteCount := byteCountOption.ConvertToNum()
-	bufSize := getNiceBuffer(byteCount)
-	buf := make([]byte, bufSize)
+// readLineChunk は -n l/N で content を chunkCount 個に分割した時の index 番目の chunk と、その先頭の位置を返す
+// readChunk で求めた chunk の境界を、それぞれ次の行の先頭まで後ろにずらす
+// 前の chunk が後ろにずれた結果、このchunkの範囲を追い越している場合は空の chunk を返す
+func readLineChunk(index uint64, chunkSize uint64, chunkCount uint64, content *io.SectionReader, sep string) (*io.SectionReader, int64, error) {
+	start, err := nextLineStart(content, int64(index*chunkSize), sep)
+	if err != nil {
+		return nil, int64(index * chunkSize), err
+	}
 
-	// optionに0が指定されている場合は全部読みこんで返す
-	if byteCountOption == 0 {
-		n, err := reader.Read(buf)
+	end := content.Size()
+	if index != chunkCount-1 {
+		end, err = nextLineStart(content, int64((index+1)*chunkSize), sep)
 		if err != nil {
-			if err == io.EOF {
-				// fmt.Println("ファイル分割が終了しました")
-				// 1バイトも書き込めなかった場合はファイルを消す
-				if readBytes == 0 {
-					_ = os.Remove(outputFile.Name())
-					return nil, fmt.Errorf("readBytes(): %w", err)
-				}
-			}
-			log.Fatalf("readBytes()で読み込みに失敗しました: %v", err)
+			return nil, start, err
 		}
-		return buf[:n], nil
 	}
 
-	for readBytes < byteCount {
-		readSize := bufSize
-		// 今回bufferのサイズ分読み込んだらbyteCountをオーバーする時
-		// (optionで指定されたbyteCount - これまで読み込んだバイト数) の分だけ読めばいい
-		if readBytes+readSize > byteCount {
-			readSize = byteCount - readBytes
+	return io.NewSectionReader(content, start, end-start), start, nil
+}
+
+// nextLineStart は content の pos 以降で最初に現れる行の先頭の位置を返す
+// 行は区切り文字 sep で区切られているものとする
+// pos がすでに行の先頭であれば pos をそのまま返し、以降に区切り文字がなければ content の終端を返す
+func nextLineStart(content *io.SectionReader, pos int64, sep string) (int64, error) {
+	size := content.Size()
+	if pos <= 0 {
+		return 0, nil
+	}
+	if pos >= size {
+		return size, nil
+	}
+
+	// 直前のバイト列が区切り文字であれば pos は行の先頭
+	if n := int64(len(sep)); pos >= n {
+		prev := make([]byte, n)
+		if _, err := content.ReadAt(prev, pos-n); err != nil {
+			return 0, fmt.Errorf("nextLineStart(): %w", err)
+		}
+		if string(prev) == sep {
+			return pos, nil
 		}
+	}
 
-		n, err := reader.Read(buf[:readSize])
-		if err != nil {
-			if err == io.EOF {
-				// fmt.Println("ファイル分割が終了しました")
-				// 1バイトも書き込めなかった場合はファイルを消す
-				if readBytes == 0 {
-					_ = os.Remove(outputFile.Name())
-					return nil, fmt.Errorf("readBytes(): %w", err)
-				}
-				// 最後に読み込んだ分は書き込んでおく
-				_, err = outputFile.Write(buf[:readBytes+uint64(n)])
-				if err != nil {
-					return nil, fmt.Errorf("readBytes(): %w", err)
-				}
-				err = outputFile.Close()
-				if err != nil {
-					return nil, fmt.Errorf("readBytes(): %w", err)
-				}
-				return nil, ErrFinishWrite
+	// 区切り文字が pos をまたいでいる場合も見つけられるように、少し手前から探す
+	from := pos - int64(len(sep)-1)
+	if from < 0 {
+		from = 0
+	}
+	pos = from
+	reader := newRecordReader(io.NewSectionReader(content, from, size-from), sep)
+	for {
+		line, err := reader.readSlice()
+		pos += int64(len(line))
+		if err == nil {
+			return pos, nil
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return size, nil
+		}
+		return 0, fmt.Errorf("nextLineStart(): %w", err)
+	}
+}
+
+// extractRoundRobin は reader の各行を chunkCount 個に順番に振り分けた時に、index 番目に振り分けられる行だけを outputFile に書き込む
+func extractRoundRobin(index uint64, chunkCount uint64, reader *recordReader, outputFile *part) error {
+	var offset int64
+	var lineIndex uint64
+	for {
+		// 1行が bufio.Reader のバッファより長い場合は、行末まで続けて書き込む
+		line, err := reader.readSlice()
+		if len(line) > 0 && lineIndex%chunkCount == index {
+			if _, werr := outputFile.Write(line); werr != nil {
+				return werr
 			}
-			// fmt.Println("バイトを読み込めませんでした")
-			log.Fatalf("readBytes()で読み込みに失敗しました: %v", err)
 		}
+		offset += int64(len(line))
 
-		readBytes += uint64(n)
+		if err == nil {
+			lineIndex++
+			continue
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return &PartError{Op: "read", Part: outputFile.name, Offset: offset, Err: err}
+	}
+}
+
+// readBytes は reader から byteCount バイト読み込み、outputFile に書き込む
+// byteCount に0が指定されている場合は reader の終端まで全部読み込んで書き込む
+// reader が byteCount バイトに満たずに終端に達した場合は、読み込めた分だけ書き込んで nil を返す
+func readBytes(byteCount uint64, reader *bufio.Reader, outputFile *part, buf []byte) error {
+	var src io.Reader = reader
+	if byteCount != 0 {
+		src = io.LimitReader(reader, int64(byteCount))
+	}
+
+	return copyPart(outputFile, src, buf)
+}
+
+// copyPart は src を終端まで読み込み、outputFile に書き込む
+// outputFile は io.ReaderFrom を実装していないので、buf を使って読み込みと書き込みを繰り返す
+func copyPart(outputFile *part, src io.Reader, buf []byte) error {
+	_, err := io.CopyBuffer(outputFile, src, buf)
+	if err != nil {
+		if _, ok := err.(*PartError); ok {
+			return err
+		}
+		return &PartError{Op: "read", Part: outputFile.name, Offset: outputFile.offset + outputFile.n, Err: err}
 	}
 
-	return buf[:readBytes], nil
+	return nil
 }
 
 func getNiceBuffer(byteCount uint64) uint64 {
@@ -0,0 +1,142 @@
+package splitter
+
+// 分割したパートの出力先を切り替えるための OutputSink とその実装
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// OutputSink は分割したパートの出力先を抽象化したもの
+// CLI.Sink に設定することで、splitの処理を変更せずにパートの書き出し先を切り替えられる
+type OutputSink interface {
+	// Create は index 番目(0始まり)のパートを name という名前で作成し、その書き込み先を返す
+	// 返した io.WriteCloser の Close が呼ばれた時点でパートが確定する
+	Create(index int, name string) (io.WriteCloser, error)
+	// Abort は作成済みのパートを破棄する
+	// 書き込みに失敗した時や、ファイル数の上限を超えた時に呼ばれる
+	Abort(name string) error
+}
+
+// FileSink は Dir 以下にパートをファイルとして書き出す OutputSink
+// Dir が空文字列の場合はカレントディレクトリに書き出す
+type FileSink struct {
+	Dir string
+}
+
+func NewFileSink(dir string) *FileSink { return &FileSink{Dir: dir} }
+
+func (f *FileSink) Create(index int, name string) (io.WriteCloser, error) {
+	return os.OpenFile(filepath.Join(f.Dir, name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+}
+
+func (f *FileSink) Abort(name string) error {
+	return os.Remove(filepath.Join(f.Dir, name))
+}
+
+// MemorySink はパートをメモリ上のバッファに書き出す OutputSink
+// テストなどでファイルシステムを使わずに分割結果を確認するために使う
+type MemorySink struct {
+	mu    sync.Mutex
+	names []string
+	parts map[string]*bytes.Buffer
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{parts: make(map[string]*bytes.Buffer)}
+}
+
+func (m *MemorySink) Create(index int, name string) (io.WriteCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.parts[name]; !ok {
+		m.names = append(m.names, name)
+	}
+	buf := &bytes.Buffer{}
+	m.parts[name] = buf
+	return &memoryPart{mu: &m.mu, buf: buf}, nil
+}
+
+func (m *MemorySink) Abort(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.parts[name]; !ok {
+		return fmt.Errorf("MemorySink.Abort(): %s: %w", name, os.ErrNotExist)
+	}
+	delete(m.parts, name)
+	for i, n := range m.names {
+		if n == name {
+			m.names = append(m.names[:i], m.names[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Names は作成されたパートの名前を作成順に返す
+func (m *MemorySink) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]string(nil), m.names...)
+}
+
+// Bytes は name という名前のパートの内容を返す
+func (m *MemorySink) Bytes(name string) []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	buf, ok := m.parts[name]
+	if !ok {
+		return nil
+	}
+	return append([]byte(nil), buf.Bytes()...)
+}
+
+type memoryPart struct {
+	mu  *sync.Mutex
+	buf *bytes.Buffer
+}
+
+func (p *memoryPart) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.buf.Write(b)
+}
+
+func (p *memoryPart) Close() error { return nil }
+
+// notifySink はパートを作成するたびに onCreate を呼び出す OutputSink
+// Splitter.OnPartCreate を全ての分割方法で呼び出すために、split で出力先を包む
+type notifySink struct {
+	OutputSink
+	mu       sync.Mutex
+	onCreate func(index int, name string)
+}
+
+func (n *notifySink) Create(index int, name string) (io.WriteCloser, error) {
+	w, err := n.OutputSink.Create(index, name)
+	if err != nil {
+		return nil, err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.onCreate(index, name)
+	return w, nil
+}
+
+// nopWriteCloser は Close しても何もしない io.WriteCloser
+// 標準出力のように、splitter が閉じてはいけない出力先をパートとして扱うために使う
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
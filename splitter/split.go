@@ -1,5 +1,5 @@
 // Package splitter は splitコマンドの仕様に従って、file を分割する処理を担当する
-// split メソッドは主に以下の処理を行う
+// Split メソッドは主に以下の処理を行う
 //
 //  1. optionに従って以下の処理を繰り返す
 //  2. 書き込み用のファイルを生成する
@@ -8,35 +8,57 @@
 //  5. 4で書き込んだファイルをクローズする
 //  6. 1に戻る
 //
-// CLI　構造体は Splitter 構造体をラップしていて、入力元ファイル(io.Reader)と出力ファイル名を切り替えられる
+// 処理中に発生した I/O エラーはプロセスを終了させずに *PartError として呼び出し元に返す
+// よって、splitter はライブラリとして他のプログラムに組み込んで使うことができる
+//
+// CLI　構造体は Splitter 構造体をラップしていて、入力元ファイル(io.Reader)と出力先(OutputSink)を切り替えられる
 // これによって、テスト時に柔軟性を持たせることが可能
 package splitter
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/ntk221/split/option"
 	"io"
-	"log"
 	"os"
-)
-
-const (
-	FileLimit string = "zz"
+	"strings"
+	"time"
 )
 
 var (
-	ErrFinishWrite = errors.New("ファイルの書き込みが終了しました")
-	ErrTooManyFile = errors.New("ファイルが生成できる上限を超えました")
-	ErrZeroChunk   = errors.New("chunkが分割可能な上限を超えています")
+	ErrTooManyFile   = errors.New("ファイルが生成できる上限を超えました")
+	ErrZeroChunk     = errors.New("chunkが分割可能な上限を超えています")
+	ErrNilInput      = errors.New("入力にnilが指定されています")
+	ErrUnknownMode   = errors.New("対応していないoptionです")
+	ErrZeroLineBytes = errors.New("1ファイルあたりのバイト数に0が指定されています")
 )
 
+// PartError はパートの open, write, close, read 時に発生したエラーを表す
+// Part はエラーが発生したパートの名前、Offset はエラー発生時点での入力の先頭からのバイト数
+type PartError struct {
+	Op     string
+	Part   string
+	Offset int64
+	Err    error
+}
+
+func (e *PartError) Error() string {
+	return fmt.Sprintf("split: %s %s (offset %d): %v", e.Op, e.Part, e.Offset, e.Err)
+}
+
+func (e *PartError) Unwrap() error { return e.Err }
+
 // CLI はSplitter構造体のラッパー
 // Input, Output をCLIで制御することができる
+// Sink が nil の場合は OutputDir 以下にファイルとして書き出す
+// Stdout は -n K/N のように1つの chunk だけを出力する場合の出力先で、nil の場合は os.Stdout に書き出す
 type CLI struct {
 	Input     io.Reader
 	OutputDir string
+	Sink      OutputSink
+	Stdout    io.Writer
 	Splitter  *Splitter
 }
 
@@ -44,163 +66,464 @@ type CLI struct {
 // split　がエラー情報を返すのでそれをそのまま呼び出しもとに返す
 func (cli *CLI) Run(option option.Command) error {
 	input := cli.Input
-	outputDir := cli.OutputDir
-	err := cli.Splitter.split(input, outputDir, option)
+	sink := cli.Sink
+	if sink == nil {
+		sink = NewFileSink(cli.OutputDir)
+	}
+	stdout := cli.Stdout
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	err := cli.Splitter.split(context.Background(), input, sink, stdout, option)
 	return err
 }
 
 type Splitter struct {
 	outputPrefix string
+
+	// SuffixLength は出力ファイル名の suffix の桁数
+	// 0 の場合は DefaultSuffixLength 桁から始めて、suffix を使い切る前に桁数を自動で増やす
+	SuffixLength int
+
+	// Suffix は出力ファイル名の suffix の生成方法
+	// nil の場合は AlphabeticSuffix を使う
+	Suffix SuffixGenerator
+
+	// AdditionalSuffix は生成した suffix の後ろに付け足す文字列 (例: ".csv")
+	AdditionalSuffix string
+
+	// NameTemplate が nil でない場合は、パートの名前を prefix + suffix ではなくテンプレートから組み立てる
+	NameTemplate *NameTemplate
+
+	// InputName は入力ファイルの名前で、NameTemplate の {basename}, {ext} に使う
+	InputName string
+
+	// Separator は -l, -C, -n l/N などで行の区切りとして扱う文字列
+	// 空文字列の場合は改行を区切りとする。複数バイトの文字列も指定できる
+	Separator string
+
+	// OnPartCreate が nil でない場合は、パートを作成するたびに index(0始まり)と名前を渡して呼び出す
+	// 並列に書き出す場合も同時には呼び出さない
+	OnPartCreate func(index int, name string)
+
+	// ManifestPath が空でない場合は、作成したパートの記録(Manifest)を JSON として書き出す
+	// 分割の途中では一定の間隔で書き出し直し、分割が終わった時は失敗した場合も書き出す
+	ManifestPath string
+
+	// OnProgress が nil でない場合は、ProgressInterval ごとに分割の進み具合を渡して呼び出す
+	// 分割が終わった時(エラーで中断した場合も含む)には Done を true にして最後に1回呼び出す
+	OnProgress func(Progress)
+	// ProgressInterval は OnProgress を呼び出す間隔で、0 の場合は DefaultProgressInterval
+	ProgressInterval time.Duration
+
+	// ElideEmpty が true の場合は、-n や csplit で空になるパートを作成しない
+	// 省いたパートは名前を消費しないので、作成されたパートの名前は連番になる
+	ElideEmpty bool
+
+	// Workers は -n, -b で分割する際に、パートを並列に書き出す goroutine の数
+	// 0 または 1 の場合と、-b で入力がランダムアクセスできない場合は先頭から順番に書き出す
+	Workers int
+}
+
+// Split は input を opt に従って分割し、カレントディレクトリにパートを書き出す
+// opt が option.ExtractChunk の場合は、指定された chunk だけを標準出力に書き出す
+// ctx がキャンセルされた場合は次のパートに進む前に処理を中断し、ctx.Err() を返す
+func (s *Splitter) Split(ctx context.Context, input io.Reader, opt option.Command) error {
+	return s.split(ctx, input, NewFileSink(""), os.Stdout, opt)
 }
 
-func (s *Splitter) split(input io.Reader, outputDir string, opt option.Command) error {
+func (s *Splitter) split(ctx context.Context, input io.Reader, sink OutputSink, stdout io.Writer, opt option.Command) error {
 	if input == nil {
-		panic("splitの呼び出し時のfileにnilが入ってきている")
+		return ErrNilInput
+	}
+	if err := s.validateSuffix(); err != nil {
+		return err
+	}
+	// -n で分割する場合はパートの総数が分割前に決まる
+	// ただし -n r/N で ElideEmpty の場合は、入力を最後まで読むまで空のパートの数が分からない
+	totalKnown := false
+	switch opt.(type) {
+	case option.ChunkCount, option.LineChunkCount:
+		totalKnown = true
+	case option.RoundRobin:
+		totalKnown = !s.ElideEmpty
+	}
+	if err := s.validateNameTemplate(totalKnown); err != nil {
+		return err
+	}
+	if s.OnPartCreate != nil {
+		sink = &notifySink{OutputSink: sink, onCreate: s.OnPartCreate}
+	}
+	if s.OnProgress != nil {
+		var tracker *progressTracker
+		input, tracker = trackProgress(input, s.OnProgress, s.ProgressInterval)
+		defer tracker.finish()
+		sink = &notifySink{OutputSink: sink, onCreate: tracker.partCreated}
+	}
+	// createPart が入力中の位置を渡せるように、recordSink は一番外側で包む
+	var records *recordSink
+	if s.ManifestPath != "" {
+		var inputSize func() int64
+		input, inputSize = measureInput(input)
+		records = newRecordSink(sink, s.separator(), s.ManifestPath, s.newManifest(opt), inputSize)
+		// 書き出せない場合は分割を始める前に失敗させる
+		if err := records.save(false); err != nil {
+			return err
+		}
+		sink = records
 	}
 
 	var err error
 	switch opt.(type) {
 	case option.LineCount:
-		err = s.splitUsingLineCount(input, outputDir, opt)
+		err = s.splitUsingLineCount(ctx, input, sink, opt)
 	case option.ChunkCount:
-		err = s.splitUsingChunkCount(input, outputDir, opt)
+		err = s.splitUsingChunkCount(ctx, input, sink, opt)
+	case option.LineChunkCount:
+		err = s.splitUsingLineChunkCount(ctx, input, sink, opt)
+	case option.RoundRobin:
+		err = s.splitUsingRoundRobin(ctx, input, sink, opt)
+	case option.ExtractChunk:
+		err = s.extractChunk(ctx, input, stdout, opt)
 	case option.ByteCount:
-		err = s.splitUsingByteCount(input, outputDir, opt)
+		err = s.splitUsingByteCount(ctx, input, sink, opt)
+	case option.LineBytes:
+		err = s.splitUsingLineBytes(ctx, input, sink, opt)
+	case option.Pattern:
+		err = s.splitUsingPattern(ctx, input, sink, opt)
+	case option.CsplitPatterns:
+		err = s.splitUsingCsplitPatterns(ctx, input, sink, opt)
 	default:
-		panic("意図しないOptionTypeです")
+		err = fmt.Errorf("split(): %T: %w", opt, ErrUnknownMode)
 	}
 
+	if records != nil {
+		// 失敗した場合も、それまでに閉じたパートの記録を書き出しておく
+		if serr := records.save(err == nil); err == nil {
+			err = serr
+		}
+	}
 	return err
 }
 
 // SplitUsingLineCount はlineCount分だけ、fileから読み込み、他のファイルに出力する
 // 事前条件: CommandOptionの種類はlineCountでなくてはならない
-func (s *Splitter) splitUsingLineCount(file io.Reader, outputDir string, lineCount option.Command) error {
-	outputSuffix := "aa"
-	outputPrefix := s.outputPrefix
+func (s *Splitter) splitUsingLineCount(ctx context.Context, file io.Reader, sink OutputSink, lineCount option.Command) error {
+	outputSuffix := s.firstSuffix()
 
 	if _, ok := lineCount.(option.LineCount); !ok {
 		panic("SplitUsingLineCountがLineCount以外のCommandOptionで呼ばれている")
 	}
 
-	reader := bufio.NewReader(file)
-	for {
-		if outputSuffix >= FileLimit {
-			deleteAllPartFile(outputPrefix)
-			return ErrTooManyFile
-		}
-
-		outputFile, err := os.OpenFile(outputDir+"/"+outputPrefix+outputSuffix, os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			return fmt.Errorf("splitUsingLineCount(): %w", err)
+	reader := newRecordReader(file, s.separator())
+	var offset int64
+	for index := 0; ; index++ {
+		if err := ctx.Err(); err != nil {
+			return err
 		}
 
 		lineCount := lineCount.ConvertToNum() // lineCountはファイルから読み込む行数
 		lines, err := readLines(lineCount, reader)
-		if err != nil {
-			// 最後まで読んだ場合の処理
-			if errors.Is(err, io.EOF) {
-				if len(lines) == 0 {
-					err = os.Remove(outputFile.Name())
-					if err != nil {
-						log.Fatal(err)
-					}
-					return nil
-				}
-				// EOFにぶつかるまでに読み込んだlineを書き出す
-				for _, line := range lines {
-					_, err = outputFile.WriteString(line)
-					if err != nil {
-						log.Fatalf("splitUsingLineCount()でファイル書き込みに失敗しました: %v", err)
-					}
-				}
-				return nil
+		if err != nil && !errors.Is(err, io.EOF) {
+			return &PartError{Op: "read", Part: s.partName(index, outputSuffix, unknownTotal), Offset: offset, Err: err}
+		}
+		// 最後まで読んだ場合の処理
+		if len(lines) == 0 {
+			return nil
+		}
+
+		// 書き出す行がある場合にだけ suffix を使い切ったかを確認する
+		// 入力がちょうど suffix の数だけのパートに収まる場合は成功させる
+		if s.suffixExhausted(outputSuffix) {
+			if err := s.deleteAllPartFile(sink); err != nil {
+				return err
 			}
-			// io.EOF以外の読み込みエラーは落とす
-			log.Fatalf("splitUsingLineCount(): %v", err)
+			return ErrTooManyFile
+		}
+
+		outputFile, perr := createPart(sink, index, s.partName(index, outputSuffix, unknownTotal), offset)
+		if perr != nil {
+			return perr
 		}
 
 		// 書き込み先のファイルに書き込む
 		for _, line := range lines {
-			_, err = outputFile.WriteString(line)
-			if err != nil {
-				log.Fatalf("splitUsingLineCount()でファイル書き込み時のエラーが発生しました: %v", err)
+			if _, perr := outputFile.Write([]byte(line)); perr != nil {
+				outputFile.abort(sink)
+				return perr
 			}
 		}
 
 		// 書き込んだファイルを閉じる
-		err = outputFile.Close()
-		if err != nil {
-			log.Fatalf("splitUsingLineCount()でファイルを閉じる際にエラーが発生しました: %v", err)
+		if perr := outputFile.Close(); perr != nil {
+			return perr
 		}
+		offset += outputFile.n
 
-		outputSuffix = incrementString(outputSuffix)
+		// EOFにぶつかるまでに読み込んだlineを書き出したら終了する
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		outputSuffix = s.nextSuffix(outputSuffix)
 	}
 }
 
-func (s *Splitter) splitUsingChunkCount(file io.Reader, outputDir string, chunkCountOption option.Command) error {
-	outputSuffix := "aa"
-	outputPrefix := s.outputPrefix
-	_ = outputPrefix
+func (s *Splitter) splitUsingChunkCount(ctx context.Context, file io.Reader, sink OutputSink, chunkCountOption option.Command) error {
+	outputSuffix := s.firstSuffix()
 
 	if _, ok := chunkCountOption.(option.ChunkCount); !ok {
 		panic("SplitUsingChunkCountがLineCount以外のCommandOptionで呼ばれている")
 	}
 
-	reader := bufio.NewReader(file)
-	content, err := io.ReadAll(reader)
+	// 入力全体をメモリに読み込まずに、入力のサイズから各chunkの範囲を計算する
+	content, cleanup, err := openSection(file)
 	if err != nil {
-		log.Fatalf("splitUsingChunkCount()でファイル読み込みに失敗しました: %v", err)
+		return &PartError{Op: "read", Part: s.partName(0, outputSuffix, int(chunkCountOption.ConvertToNum())), Err: err}
 	}
+	defer cleanup()
 
 	chunkCount := chunkCountOption.ConvertToNum()
-	chunkSize := uint64(len(content)) / chunkCount
-
-	if chunkSize == 0 {
+	if chunkCount == 0 {
 		return ErrZeroChunk
 	}
+	chunkSize := chunkSizeOf(content.Size(), chunkCount)
 
+	// 各chunkの範囲と出力するパートの名前を事前に決めておく
+	// chunkCount は入力のバイト数より大きい場合もあるので、chunkCount 個分の領域は確保しない
+	var ranges []partRange
 	var i uint64
 	for i = 0; i < chunkCount; i++ {
-		if outputSuffix >= FileLimit {
-			deleteAllPartFile(outputPrefix)
-			return ErrTooManyFile
+		// iは分割したchunkに割り振ったindex
+		chunk, start := readChunk(i, chunkSize, chunkCount, content)
+		if s.ElideEmpty && chunk.Size() == 0 {
+			// 入力の終端に達した後の chunk は全て空になる
+			if start >= content.Size() {
+				break
+			}
+			continue
 		}
+		ranges = append(ranges, partRange{offset: start, section: chunk})
+	}
+	if err := s.nameRanges(ranges); err != nil {
+		return err
+	}
+
+	return writeParts(ctx, sink, ranges, s.Workers, getNiceBuffer(chunkSize))
+}
+
+// splitUsingLineChunkCount は -n l/N に対応する
+// ChunkCount と同様に入力をおおよそ同じサイズの chunk に分けるが、各 chunk の終わりを次の改行まで後ろにずらす
+// そのため、前の chunk が後ろにずれた結果、空になる chunk もある
+func (s *Splitter) splitUsingLineChunkCount(ctx context.Context, file io.Reader, sink OutputSink, lineChunkCountOption option.Command) error {
+	outputSuffix := s.firstSuffix()
 
-		outputFile, err := os.OpenFile(outputDir+"/"+outputPrefix+outputSuffix, os.O_CREATE|os.O_WRONLY, 0644)
+	if _, ok := lineChunkCountOption.(option.LineChunkCount); !ok {
+		panic("SplitUsingLineChunkCountがLineChunkCount以外のCommandOptionで呼ばれている")
+	}
+
+	content, cleanup, err := openSection(file)
+	if err != nil {
+		return &PartError{Op: "read", Part: s.partName(0, outputSuffix, int(lineChunkCountOption.ConvertToNum())), Err: err}
+	}
+	defer cleanup()
+
+	chunkCount := lineChunkCountOption.ConvertToNum()
+	if chunkCount == 0 {
+		return ErrZeroChunk
+	}
+	chunkSize := chunkSizeOf(content.Size(), chunkCount)
+
+	var ranges []partRange
+	var i uint64
+	for i = 0; i < chunkCount; i++ {
+		chunk, start, err := readLineChunk(i, chunkSize, chunkCount, content, s.separator())
 		if err != nil {
-			log.Fatalf("splitUsingChunkCount()でファイルオープンに失敗しました: %v", err)
+			return &PartError{Op: "read", Part: s.partName(len(ranges), outputSuffix, int(chunkCount)), Offset: start, Err: err}
 		}
+		if s.ElideEmpty && chunk.Size() == 0 {
+			// 入力の終端に達した後の chunk は全て空になる
+			if start >= content.Size() {
+				break
+			}
+			continue
+		}
+		ranges = append(ranges, partRange{offset: start, section: chunk})
+	}
+	if err := s.nameRanges(ranges); err != nil {
+		return err
+	}
 
-		// 読み込みファイルから読み込む
-		// iは分割したchunkに割り振ったindex
-		chunk, ok := readChunk(i, chunkSize, chunkCount, content)
-		if !ok {
-			err = os.Remove(outputFile.Name())
-			if err != nil {
-				log.Fatal(err)
+	return writeParts(ctx, sink, ranges, s.Workers, getNiceBuffer(chunkSize))
+}
+
+// splitUsingRoundRobin は -n r/N に対応する
+// 入力の各行を先頭のパートから順番に振り分ける
+// 各パートは最初の行を書き込む時に名前を決めて開くので、ElideEmpty の場合は空のパートを作成せず、N 個分の領域も確保しない
+// 入力は1行ずつ読み込んで書き出すので、入力全体をメモリに読み込むことはない
+func (s *Splitter) splitUsingRoundRobin(ctx context.Context, file io.Reader, sink OutputSink, roundRobinOption option.Command) error {
+	outputSuffix := s.firstSuffix()
+
+	if _, ok := roundRobinOption.(option.RoundRobin); !ok {
+		panic("SplitUsingRoundRobinがRoundRobin以外のCommandOptionで呼ばれている")
+	}
+
+	partCount := roundRobinOption.ConvertToNum()
+	if partCount == 0 {
+		return ErrZeroChunk
+	}
+
+	// 行は先頭のパートから順番に振り分けるので、まだ開いていないパートは常に len(outputFiles) 番目になる
+	var outputFiles []*part
+	// 途中で失敗した場合は、それまでに開いたパートを全て破棄する
+	abortAll := func() {
+		for _, outputFile := range outputFiles {
+			outputFile.abort(sink)
+		}
+	}
+	// ElideEmpty の場合は {total} を使えないので、total は常に partCount になる
+	nextName := func() string {
+		return s.partName(len(outputFiles), outputSuffix, int(partCount))
+	}
+	open := func(index uint64) (*part, error) {
+		if index < uint64(len(outputFiles)) {
+			return outputFiles[index], nil
+		}
+		if s.suffixExhausted(outputSuffix) {
+			return nil, ErrTooManyFile
+		}
+		outputFile, perr := createPart(sink, len(outputFiles), nextName(), 0)
+		if perr != nil {
+			return nil, perr
+		}
+		outputFiles = append(outputFiles, outputFile)
+		outputSuffix = s.nextSuffix(outputSuffix)
+		return outputFile, nil
+	}
+
+	reader := newRecordReader(file, s.separator())
+	var offset int64
+	var lineIndex uint64
+	for {
+		if err := ctx.Err(); err != nil {
+			abortAll()
+			return err
+		}
+
+		// 1行が bufio.Reader のバッファより長い場合は、行末まで同じパートに書き込む
+		line, err := reader.readSlice()
+		if len(line) > 0 {
+			outputFile, oerr := open(lineIndex % partCount)
+			if oerr != nil {
+				if perr, ok := oerr.(*PartError); ok {
+					perr.Offset = offset
+				}
+				abortAll()
+				return oerr
 			}
-			return fmt.Errorf("splitUsingChunkCount(): %w", err)
+			if _, werr := outputFile.Write(line); werr != nil {
+				// パート内のオフセットではなく、入力の先頭からのオフセットを返す
+				if perr, ok := werr.(*PartError); ok {
+					perr.Offset = offset
+				}
+				abortAll()
+				return werr
+			}
+			offset += int64(len(line))
 		}
 
-		_, err = outputFile.Write(chunk)
-		if err != nil {
-			log.Fatalf("splitUsingChunkCount()でファイル書き込みに失敗しました: %v", err)
+		if err == nil {
+			lineIndex++
+			continue
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
 		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		name := nextName()
+		if index := lineIndex % partCount; index < uint64(len(outputFiles)) {
+			name = outputFiles[index].name
+		}
+		abortAll()
+		return &PartError{Op: "read", Part: name, Offset: offset, Err: err}
+	}
 
-		err = outputFile.Close()
-		if err != nil {
-			log.Fatalf("splitUsingChunkCount()でファイルのクローズに失敗しました: %v", err)
+	// 行数が partCount に満たない場合は後ろのパートが空になる
+	// 空のパートは末尾にしかないので、ElideEmpty で作成しなくてもパートの名前は連番のままである
+	if !s.ElideEmpty {
+		for index := uint64(len(outputFiles)); index < partCount; index++ {
+			if _, perr := open(index); perr != nil {
+				abortAll()
+				return perr
+			}
 		}
+	}
 
-		outputSuffix = incrementString(outputSuffix)
+	// 1つのパートを閉じられなくても、残りのパートを閉じる (FilterSink ではコマンドの終了を待つ)
+	var partErrs PartErrors
+	for _, outputFile := range outputFiles {
+		if perr := outputFile.Close(); perr != nil {
+			partErrs = append(partErrs, perr)
+		}
 	}
+	switch len(partErrs) {
+	case 0:
+		return nil
+	case 1:
+		return partErrs[0]
+	default:
+		return partErrs
+	}
+}
 
-	return nil
+// extractChunk は -n K/N, l/K/N, r/K/N に対応する
+// N 個に分割した時の K 番目の chunk だけを計算して stdout に書き出し、パートは作成しない
+// K/N, l/K/N では入力がファイルであれば chunk の範囲まで直接 seek して読み込む
+func (s *Splitter) extractChunk(ctx context.Context, file io.Reader, stdout io.Writer, extractOption option.Command) error {
+	var extract option.ExtractChunk
+	var ok bool
+	if extract, ok = extractOption.(option.ExtractChunk); !ok {
+		panic("extractChunkがExtractChunk以外のCommandOptionで呼ばれている")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	out := &part{name: "stdout", w: nopWriteCloser{stdout}}
+	chunkCount := extract.ConvertToNum()
+	index := uint64(extract.Index - 1)
+
+	if extract.Kind == option.RoundRobinChunk {
+		return extractRoundRobin(index, chunkCount, newRecordReader(file, s.separator()), out)
+	}
+
+	content, cleanup, err := openSection(file)
+	if err != nil {
+		return &PartError{Op: "read", Part: out.name, Err: err}
+	}
+	defer cleanup()
+
+	chunkSize := chunkSizeOf(content.Size(), chunkCount)
+
+	var chunk *io.SectionReader
+	switch extract.Kind {
+	case option.LineChunk:
+		chunk, out.offset, err = readLineChunk(index, chunkSize, chunkCount, content, s.separator())
+		if err != nil {
+			return &PartError{Op: "read", Part: out.name, Offset: out.offset, Err: err}
+		}
+	default:
+		chunk, out.offset = readChunk(index, chunkSize, chunkCount, content)
+	}
+
+	return copyPart(out, chunk, make([]byte, getNiceBuffer(chunkSize)))
 }
 
-func (s *Splitter) splitUsingByteCount(file io.Reader, outputDir string, byteCountOption option.Command) error {
-	outputSuffix := "aa"
+func (s *Splitter) splitUsingByteCount(ctx context.Context, file io.Reader, sink OutputSink, byteCountOption option.Command) error {
+	outputSuffix := s.firstSuffix()
 
 	var byteCount option.ByteCount
 	var ok bool
@@ -208,76 +531,289 @@ func (s *Splitter) splitUsingByteCount(file io.Reader, outputDir string, byteCou
 		panic("SplitUsingByteCountがByteCount以外のCommandOptionで呼ばれている")
 	}
 
-	outputPrefix := s.outputPrefix
+	// 入力がランダムアクセス可能な場合は各パートの範囲が事前に分かるので、並列に書き出せる
+	if s.Workers > 1 {
+		if content, ok := sectionOf(file); ok {
+			return s.splitSectionUsingByteCount(ctx, content, sink, byteCount)
+		}
+	}
 
 	reader := bufio.NewReader(file)
+	buf := make([]byte, getNiceBuffer(byteCount.ConvertToNum()))
 
-	for {
-		if outputSuffix >= FileLimit {
-			deleteAllPartFile(outputPrefix)
-			return ErrTooManyFile
+	var offset int64
+	for index := 0; ; index++ {
+		if err := ctx.Err(); err != nil {
+			return err
 		}
 
-		outputFile, err := os.OpenFile(outputDir+"/"+outputPrefix+outputSuffix, os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			log.Fatalf("splitUsingByteCount()でファイルのオープンに失敗しました: %v", err)
+		// 1バイトも読み込めない場合はファイルを作らずに終了する
+		if _, err := reader.Peek(1); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return &PartError{Op: "read", Part: s.partName(index, outputSuffix, unknownTotal), Offset: offset, Err: err}
 		}
 
-		buf, err := readBytes(byteCount, reader, outputFile)
-		if err != nil {
-			if errors.Is(err, io.EOF) || errors.Is(err, ErrFinishWrite) {
-				return fmt.Errorf("splitUsingByteCount(): %w", err)
+		if s.suffixExhausted(outputSuffix) {
+			if err := s.deleteAllPartFile(sink); err != nil {
+				return err
 			}
-			return fmt.Errorf("splitUsingByteCount(): %w", err)
+			return ErrTooManyFile
 		}
 
-		_, err = outputFile.Write(buf)
-		if err != nil {
-			log.Fatalf("splitUsingByteCount()でファイルの書き込み処理に失敗しました: %v", err)
+		outputFile, perr := createPart(sink, index, s.partName(index, outputSuffix, unknownTotal), offset)
+		if perr != nil {
+			return perr
 		}
 
-		err = outputFile.Close()
-		if err != nil {
-			log.Fatalf("splitUsingByteCount()でファイルのクローズに失敗しました: %v", err)
+		if err := readBytes(byteCount.ConvertToNum(), reader, outputFile, buf); err != nil {
+			outputFile.abort(sink)
+			return err
+		}
+
+		if perr := outputFile.Close(); perr != nil {
+			return perr
 		}
+		offset += outputFile.n
 
-		outputSuffix = incrementString(outputSuffix)
+		outputSuffix = s.nextSuffix(outputSuffix)
 	}
 }
 
-// 文字列用のincrement関数
-// ex: incrementString("a") == "b"
-// ex: incrementString("az") == "ba"
-func incrementString(s string) string {
-	runes := []rune(s)
-	for i := len(runes) - 1; i >= 0; i-- {
-		if runes[i] < 'z' {
-			runes[i]++
-			return string(runes)
+// splitUsingLineBytes は -C に対応する
+// 各パートが lineBytes バイトを超えない範囲で、できるだけ多くの行を行の途中で分断せずに書き込む
+// 1行が lineBytes バイトより長い場合に限り、その行を lineBytes バイトごとに分割する
+func (s *Splitter) splitUsingLineBytes(ctx context.Context, file io.Reader, sink OutputSink, lineBytesOption option.Command) error {
+	outputSuffix := s.firstSuffix()
+
+	if _, ok := lineBytesOption.(option.LineBytes); !ok {
+		panic("SplitUsingLineBytesがLineBytes以外のCommandOptionで呼ばれている")
+	}
+
+	limit := int64(lineBytesOption.ConvertToNum())
+	if limit <= 0 {
+		return ErrZeroLineBytes
+	}
+
+	reader := newRecordReader(file, s.separator())
+	var offset int64
+	var outputFile *part
+	// 書き込み中のパートを閉じて、次のパートの名前に進める
+	closePart := func() error {
+		if outputFile == nil {
+			return nil
 		}
-		runes[i] = 'a'
+		perr := outputFile.Close()
+		outputFile = nil
+		outputSuffix = s.nextSuffix(outputSuffix)
+		return perr
 	}
 
-	return "a" + string(runes)
+	for index := 0; ; {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		line, err := readLineAtMost(reader, int(limit))
+		if err != nil && !errors.Is(err, io.EOF) {
+			if outputFile != nil {
+				outputFile.abort(sink)
+			}
+			return &PartError{Op: "read", Part: s.partName(index, outputSuffix, unknownTotal), Offset: offset, Err: err}
+		}
+
+		if len(line) > 0 {
+			// 今のパートにこの行が収まらない場合は次のパートに書き込む
+			if outputFile != nil && outputFile.n+int64(len(line)) > limit {
+				if perr := closePart(); perr != nil {
+					return perr
+				}
+			}
+
+			if outputFile == nil {
+				if s.suffixExhausted(outputSuffix) {
+					if err := s.deleteAllPartFile(sink); err != nil {
+						return err
+					}
+					return ErrTooManyFile
+				}
+
+				var perr error
+				outputFile, perr = createPart(sink, index, s.partName(index, outputSuffix, unknownTotal), offset)
+				if perr != nil {
+					return perr
+				}
+				index++
+			}
+
+			if _, perr := outputFile.Write(line); perr != nil {
+				outputFile.abort(sink)
+				return perr
+			}
+			offset += int64(len(line))
+		}
+
+		if errors.Is(err, io.EOF) {
+			return closePart()
+		}
+	}
 }
 
-// ファイルの上限数を上回る場合に呼ばれる
-// 作成した全てのファイルを消去する
-func deleteAllPartFile(outputPrefix string) {
-	outputSuffix := "aa"
-	for outputSuffix < FileLimit {
-		partName := fmt.Sprintf("%s%s", outputPrefix, outputSuffix)
-		partFileName := fmt.Sprintf("%s", partName)
-		err := os.Remove(partFileName)
-		if err != nil {
-			log.Fatal(err)
+// splitUsingPattern は -p に対応する
+// 正規表現にマッチする行が現れるたびに新しいパートを作り、マッチした行をそのパートの先頭に書き込む
+// 先頭の行がマッチした場合に空のパートは作らない
+func (s *Splitter) splitUsingPattern(ctx context.Context, file io.Reader, sink OutputSink, patternOption option.Command) error {
+	outputSuffix := s.firstSuffix()
+
+	var pattern option.Pattern
+	var ok bool
+	if pattern, ok = patternOption.(option.Pattern); !ok {
+		panic("SplitUsingPatternがPattern以外のCommandOptionで呼ばれている")
+	}
+	if pattern.Regexp == nil {
+		return fmt.Errorf("splitUsingPattern(): %w", ErrUnknownMode)
+	}
+
+	reader := newRecordReader(file, s.separator())
+	var offset int64
+	var outputFile *part
+	for index := 0; ; {
+		if err := ctx.Err(); err != nil {
+			if outputFile != nil {
+				outputFile.abort(sink)
+			}
+			return err
+		}
+
+		lines, err := readLines(1, reader)
+		if err != nil && !errors.Is(err, io.EOF) {
+			if outputFile != nil {
+				outputFile.abort(sink)
+			}
+			return &PartError{Op: "read", Part: s.partName(index, outputSuffix, unknownTotal), Offset: offset, Err: err}
+		}
+
+		for _, line := range lines {
+			// マッチした行から新しいパートに書き込む
+			if outputFile != nil && outputFile.n > 0 && pattern.Regexp.MatchString(strings.TrimSuffix(line, s.separator())) {
+				if perr := outputFile.Close(); perr != nil {
+					return perr
+				}
+				outputFile = nil
+				outputSuffix = s.nextSuffix(outputSuffix)
+			}
+
+			if outputFile == nil {
+				if s.suffixExhausted(outputSuffix) {
+					if err := s.deleteAllPartFile(sink); err != nil {
+						return err
+					}
+					return ErrTooManyFile
+				}
+
+				var perr error
+				outputFile, perr = createPart(sink, index, s.partName(index, outputSuffix, unknownTotal), offset)
+				if perr != nil {
+					return perr
+				}
+				index++
+			}
+
+			if _, perr := outputFile.Write([]byte(line)); perr != nil {
+				outputFile.abort(sink)
+				return perr
+			}
+			offset += int64(len(line))
+		}
+
+		if errors.Is(err, io.EOF) {
+			if outputFile == nil {
+				return nil
+			}
+			return outputFile.Close()
+		}
+	}
+}
+
+// splitSectionUsingByteCount は content を byteCount ごとの範囲に分け、Workers 個の goroutine で並列に書き出す
+func (s *Splitter) splitSectionUsingByteCount(ctx context.Context, content *io.SectionReader, sink OutputSink, byteCount option.ByteCount) error {
+	outputSuffix := s.firstSuffix()
+
+	size := content.Size()
+	step := int64(byteCount.ConvertToNum())
+	// optionに0が指定されている場合は全部を1つのパートにする
+	if step == 0 {
+		step = size
+	}
+
+	var ranges []partRange
+	for offset := int64(0); offset < size; offset += step {
+		if s.suffixExhausted(outputSuffix) {
+			return ErrTooManyFile
+		}
+
+		length := step
+		if offset+length > size {
+			length = size - offset
 		}
-		outputSuffix = incrementString(outputSuffix)
+		ranges = append(ranges, partRange{index: len(ranges), name: s.partName(len(ranges), outputSuffix, unknownTotal), offset: offset, section: io.NewSectionReader(content, offset, length)})
+
+		outputSuffix = s.nextSuffix(outputSuffix)
+	}
+
+	return writeParts(ctx, sink, ranges, s.Workers, getNiceBuffer(uint64(step)))
+}
+
+// part は書き込み中のパートを表す
+// 書き込み時、クローズ時のエラーをパート名とオフセット付きの *PartError に変換する
+type part struct {
+	name   string
+	offset int64 // パートの先頭が入力の何バイト目にあたるか
+	n      int64 // パートに書き込んだバイト数
+	w      io.WriteCloser
+}
+
+func createPart(sink OutputSink, index int, name string, offset int64) (*part, error) {
+	var w io.WriteCloser
+	var err error
+	// --manifest でパートの入力中の位置を記録する場合
+	if records, ok := sink.(*recordSink); ok {
+		w, err = records.createAt(index, name, offset)
+	} else {
+		w, err = sink.Create(index, name)
+	}
+	if err != nil {
+		return nil, &PartError{Op: "open", Part: name, Offset: offset, Err: err}
+	}
+	return &part{name: name, offset: offset, w: w}, nil
+}
+
+func (p *part) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.n += int64(n)
+	if err != nil {
+		return n, &PartError{Op: "write", Part: p.name, Offset: p.offset + p.n, Err: err}
+	}
+	return n, nil
+}
+
+func (p *part) Close() error {
+	if err := p.w.Close(); err != nil {
+		return &PartError{Op: "close", Part: p.name, Offset: p.offset + p.n, Err: err}
 	}
+	return nil
+}
+
+// abort は書き込みに失敗したパートを閉じて破棄する
+// 元のエラーを呼び出し元に返すため、ここで発生したエラーは無視する
+func (p *part) abort(sink OutputSink) {
+	_ = p.w.Close()
+	_ = sink.Abort(p.name)
 }
 
 func New(outputPrefix string) *Splitter {
 	return &Splitter{
-		outputPrefix,
+		outputPrefix: outputPrefix,
 	}
 }
@@ -0,0 +1,219 @@
+package splitter
+
+// 出力ファイル名の suffix を生成する関数群
+// suffix は SuffixLength 桁で、デフォルトでは "aa", "ab", ..., "zz" の順に増えていく
+// Splitter.Suffix に NumericSuffix, HexSuffix を設定すると "00", "01", ... のように数字の suffix になる
+// パートの名前は prefix + suffix + AdditionalSuffix か、NameTemplate で組み立てたものになる
+//
+// SuffixLength も suffix の開始値も指定されていない場合は GNU split と同様に、suffix を使い切る前に桁数を自動で増やす
+// 先頭の文字が最後の文字('z', '9' など)になる直前で2桁増やすので、"yz" の次は "zaaa"、"zyzz" の次は "zzaaaa" になる
+// 増やした後の suffix は必ずそれまでの suffix より辞書順で後ろになるので、ファイル名の順番とパートの順番が一致する
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultSuffixLength は -a が指定されていない場合の suffix の桁数
+const DefaultSuffixLength = 2
+
+const (
+	alphabeticDigits = "abcdefghijklmnopqrstuvwxyz"
+	decimalDigits    = "0123456789"
+	hexDigits        = "0123456789abcdef"
+)
+
+var (
+	ErrSuffixStart      = errors.New("suffixの開始値がsuffixの桁数で表せません")
+	ErrAdditionalSuffix = errors.New("追加のsuffixにディレクトリの区切り文字は使えません")
+)
+
+// SuffixGenerator は出力ファイル名の suffix を生成する
+type SuffixGenerator interface {
+	// First は length 桁の最初の suffix を返す
+	// 開始値が length 桁で表せない場合は ErrSuffixStart を返す
+	First(length int) (string, error)
+	// Next は suffix の次の suffix を返す
+	// suffix の桁数で表せる範囲を超えた場合は、1桁多い suffix を返す
+	Next(suffix string) string
+	// Digits は suffix の各桁に使う文字を小さい順に並べたもの
+	Digits() string
+}
+
+// AlphabeticSuffix は "aa", "ab", ..., "zz" のようにアルファベットの suffix を生成する
+func AlphabeticSuffix() SuffixGenerator { return alphabeticSuffix{} }
+
+// NumericSuffix は "00", "01", ..., "99" のように10進数の suffix を from から生成する
+func NumericSuffix(from int) SuffixGenerator { return numberSuffix{digits: decimalDigits, from: from} }
+
+// HexSuffix は "00", "01", ..., "ff" のように16進数の suffix を from から生成する
+func HexSuffix(from int) SuffixGenerator { return numberSuffix{digits: hexDigits, from: from} }
+
+// WideningNumericSuffix は csplit と同様に、SuffixLength を最小の桁数とする10進数の suffix を "00" から生成する
+// suffix の桁数で表せる範囲を超えると "99" の次は "100" のように1桁ずつ増えていき、suffix を使い切ることはない
+func WideningNumericSuffix() SuffixGenerator {
+	return wideningSuffix{numberSuffix{digits: decimalDigits}}
+}
+
+type alphabeticSuffix struct{}
+
+func (alphabeticSuffix) First(length int) (string, error) { return strings.Repeat("a", length), nil }
+func (alphabeticSuffix) Next(suffix string) string        { return incrementString(suffix) }
+func (alphabeticSuffix) Digits() string                   { return alphabeticDigits }
+
+// numberSuffix は digits を使った len(digits) 進数の suffix
+type numberSuffix struct {
+	digits string
+	from   int
+}
+
+func (n numberSuffix) First(length int) (string, error) {
+	if n.from < 0 {
+		return "", fmt.Errorf("%d: %w", n.from, ErrSuffixStart)
+	}
+
+	base := len(n.digits)
+	suffix := make([]byte, length)
+	value := n.from
+	for i := length - 1; i >= 0; i-- {
+		suffix[i] = n.digits[value%base]
+		value /= base
+	}
+	if value != 0 {
+		return "", fmt.Errorf("%d: %w", n.from, ErrSuffixStart)
+	}
+	return string(suffix), nil
+}
+
+func (n numberSuffix) Next(suffix string) string { return incrementDigits(suffix, n.digits) }
+func (n numberSuffix) Digits() string            { return n.digits }
+
+// wideningSuffix は桁数の上限を持たない numberSuffix
+type wideningSuffix struct {
+	numberSuffix
+}
+
+// Next は suffix を数として1増やした suffix を返す
+// incrementDigits と異なり、"99" の次は "000" ではなく "100" になる
+func (w wideningSuffix) Next(suffix string) string {
+	next := incrementDigits(suffix, w.digits)
+	if len(next) > len(suffix) {
+		return w.digits[1:2] + next[1:]
+	}
+	return next
+}
+
+func (s *Splitter) suffixLength() int {
+	if s.SuffixLength <= 0 {
+		return DefaultSuffixLength
+	}
+	return s.SuffixLength
+}
+
+func (s *Splitter) suffixGenerator() SuffixGenerator {
+	if s.Suffix == nil {
+		return AlphabeticSuffix()
+	}
+	return s.Suffix
+}
+
+// validateSuffix は最初の suffix が生成できるかを確認する
+func (s *Splitter) validateSuffix() error {
+	if strings.ContainsRune(s.AdditionalSuffix, '/') {
+		return fmt.Errorf("%s: %w", s.AdditionalSuffix, ErrAdditionalSuffix)
+	}
+
+	_, err := s.suffixGenerator().First(s.suffixLength())
+	return err
+}
+
+// firstSuffix は最初のパートの suffix を返す
+// ex: SuffixLength が 3 の場合は "aaa"
+// 事前条件: validateSuffix で最初の suffix が生成できることを確認している
+func (s *Splitter) firstSuffix() string {
+	first, _ := s.suffixGenerator().First(s.suffixLength())
+	return first
+}
+
+// autoExtend は suffix の桁数を自動で増やすかを返す
+// SuffixLength で桁数が明示されている場合は増やさない
+// GNU split と同様に、NumericSuffix, HexSuffix に開始値が指定されている場合も増やさない
+// 開始値の先頭が最後の文字('9', 'f')だと、桁数を増やした suffix が辞書順で前に来てしまうため
+func (s *Splitter) autoExtend() bool {
+	switch gen := s.suffixGenerator().(type) {
+	case numberSuffix:
+		if gen.from > 0 {
+			return false
+		}
+	case wideningSuffix:
+		return false
+	}
+	return s.SuffixLength <= 0
+}
+
+// nextSuffix は suffix の次のパートの suffix を返す
+func (s *Splitter) nextSuffix(suffix string) string {
+	gen := s.suffixGenerator()
+	next := gen.Next(suffix)
+	if !s.autoExtend() {
+		return next
+	}
+
+	// 先頭の fixed 文字は桁数を増やした時に付け足した最後の文字
+	digits := gen.Digits()
+	first, last := digits[:1], digits[len(digits)-1:]
+	fixed := (len(suffix) - s.suffixLength()) / 2
+	if len(next) == len(suffix) && next[fixed:fixed+1] == last {
+		return strings.Repeat(last, fixed+1) + strings.Repeat(first, len(suffix)-fixed+1)
+	}
+	return next
+}
+
+// suffixExhausted は suffix が SuffixLength 桁で表せる範囲を超えているかを返す
+// ex: SuffixLength が 2 の場合、incrementString("zz") == "aaa" は範囲を超えている
+// 桁数を自動で増やす場合や、WideningNumericSuffix の場合は使い切ることはない
+func (s *Splitter) suffixExhausted(suffix string) bool {
+	if _, ok := s.suffixGenerator().(wideningSuffix); ok || s.autoExtend() {
+		return false
+	}
+	return len(suffix) > s.suffixLength()
+}
+
+// 文字列用のincrement関数
+// ex: incrementString("a") == "b"
+// ex: incrementString("az") == "ba"
+func incrementString(s string) string {
+	return incrementDigits(s, alphabeticDigits)
+}
+
+// incrementDigits は s を digits を使った len(digits) 進数とみなして1増やす
+// ex: incrementDigits("09", "0123456789") == "10"
+// ex: incrementDigits("99", "0123456789") == "100"
+func incrementDigits(s string, digits string) string {
+	b := []byte(s)
+	for i := len(b) - 1; i >= 0; i-- {
+		j := strings.IndexByte(digits, b[i])
+		if j < len(digits)-1 {
+			b[i] = digits[j+1]
+			return string(b)
+		}
+		b[i] = digits[0]
+	}
+
+	return digits[:1] + string(b)
+}
+
+// ファイルの上限数を上回る場合に呼ばれる
+// 作成した全てのファイルを消去する
+func (s *Splitter) deleteAllPartFile(sink OutputSink) error {
+	outputSuffix := s.firstSuffix()
+	for index := 0; !s.suffixExhausted(outputSuffix); index++ {
+		err := sink.Abort(s.partName(index, outputSuffix, unknownTotal))
+		if err != nil {
+			return fmt.Errorf("deleteAllPartFile(): %w", err)
+		}
+		outputSuffix = s.nextSuffix(outputSuffix)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package splitter
+
+// 分割したパートを Manifest と照合する処理
+// パートを転送した後、join で連結する前に、全てのパートが壊れずに揃っているかを確認するために使う
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// PartStatus はパートを Manifest と照合した結果
+type PartStatus int
+
+const (
+	PartOK         PartStatus = iota
+	PartMissing               // パートが存在しない
+	PartTruncated             // パートが記録されたバイト数より短い
+	PartCorrupted             // パートの SHA-256 が記録されたものと一致しない
+	PartExtra                 // Manifest に記録されていないパートが存在する
+	PartNoChecksum            // パートは存在するが、そのチェックサムファイルがない
+)
+
+func (p PartStatus) String() string {
+	switch p {
+	case PartOK:
+		return "OK"
+	case PartMissing:
+		return "missing"
+	case PartTruncated:
+		return "truncated"
+	case PartCorrupted:
+		return "corrupted"
+	case PartExtra:
+		return "extra"
+	case PartNoChecksum:
+		return "no checksum"
+	}
+	return fmt.Sprintf("PartStatus(%d)", int(p))
+}
+
+// VerifyResult はパート1つ分の照合結果
+// Length は実際のパートのバイト数、Want は Manifest に記録されたバイト数
+type VerifyResult struct {
+	Name   string
+	Status PartStatus
+	Length int64
+	Want   int64
+}
+
+// Verify は m に記録された各パートを dir から読み直して照合し、その結果を記録された順番に返す
+// Splitter の設定(prefix, suffix, AdditionalSuffix, NameTemplate)から組み立てた名前のうち、m に記録されていないパートが dir にあれば PartExtra として末尾に加える
+// パートを転送しても照合できるように、m に記録された名前にディレクトリが含まれていても dir の直下から探す
+// パートが存在しない場合は PartMissing として扱い、それ以外の I/O エラーは *PartError として返す
+func (s *Splitter) Verify(ctx context.Context, dir string, m *Manifest) ([]VerifyResult, error) {
+	buf := make([]byte, 64*1024)
+	known := make(map[string]bool, len(m.Parts))
+	results := make([]VerifyResult, 0, len(m.Parts))
+	for _, info := range m.Parts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		name := filepath.Base(info.Name)
+		known[name] = true
+
+		result, err := verifyPart(filepath.Join(dir, name), info, buf)
+		if err != nil {
+			return nil, &PartError{Op: "read", Part: name, Offset: result.Length, Err: err}
+		}
+		result.Name = name
+		results = append(results, result)
+	}
+
+	extra, err := s.extraParts(dir, known)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range extra {
+		results = append(results, VerifyResult{Name: name, Status: PartExtra, Want: unknownLength})
+	}
+	return results, nil
+}
+
+// verifyPart は path の内容を info と照合する
+// 記録されたバイト数より短いパートは、SHA-256 も一致しないので PartTruncated として扱う
+func verifyPart(path string, info PartInfo, buf []byte) (VerifyResult, error) {
+	result := VerifyResult{Want: info.Length}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		result.Status = PartMissing
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	defer f.Close()
+
+	// パートごとのチェックサムファイルがない場合は、照合できないことだけを報告する
+	if info.SHA256 == "" {
+		result.Status = PartNoChecksum
+		return result, nil
+	}
+
+	hash := sha256.New()
+	result.Length, err = io.CopyBuffer(hash, f, buf)
+	if err != nil {
+		return result, err
+	}
+
+	switch {
+	case info.Length != unknownLength && result.Length < info.Length:
+		result.Status = PartTruncated
+	case hex.EncodeToString(hash.Sum(nil)) != info.SHA256:
+		result.Status = PartCorrupted
+	}
+	return result, nil
+}
+
+// extraParts は Splitter の設定から組み立てたパートの名前のうち、known に含まれずに dir に存在するものを返す
+func (s *Splitter) extraParts(dir string, known map[string]bool) ([]string, error) {
+	exists, err := readEntries(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Verify(): %w", err)
+	}
+	names, err := s.walkPartNames(exists, func(name string) bool { return known[name] })
+	if err != nil {
+		return nil, err
+	}
+
+	var extra []string
+	for _, name := range names {
+		if exists[name] && !known[name] {
+			extra = append(extra, name)
+		}
+	}
+	return extra, nil
+}
+
+var ErrNoSidecar = errors.New("パートごとのチェックサムファイルが見つかりません")
+
+// SidecarSuffix はパートごとのチェックサムファイルの名前に付ける suffix
+// ex: パート "xaa" のチェックサムファイルは "xaa.sha256"
+const SidecarSuffix = ".sha256"
+
+// ReadSidecars は dir にあるパートごとのチェックサムファイル(sha256sum の出力形式)を読み込み、Manifest として返す
+// パートの名前は Splitter の設定から組み立てるので、チェックサムファイルだけが残っているパートも記録に含まれる
+// パートが存在するのにチェックサムファイルがない場合は、SHA256 を空文字列にして記録に含める (Verify はそれを PartNoChecksum として報告する)
+// チェックサムファイルが1つもない場合は ErrNoSidecar を返す
+func (s *Splitter) ReadSidecars(dir string) (*Manifest, error) {
+	exists, err := readEntries(dir)
+	if err != nil {
+		return nil, fmt.Errorf("ReadSidecars(): %w", err)
+	}
+	hasSidecar := func(name string) bool { return exists[name+SidecarSuffix] }
+	names, err := s.walkPartNames(exists, hasSidecar)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{Size: unknownLength}
+	sidecars := 0
+	for index, name := range names {
+		if !hasSidecar(name) {
+			if exists[name] {
+				m.Parts = append(m.Parts, PartInfo{Index: index, Name: name, Length: unknownLength, Lines: unknownLength})
+			}
+			continue
+		}
+		sidecars++
+
+		path := filepath.Join(dir, name+SidecarSuffix)
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("ReadSidecars(): %w", err)
+		}
+		checksums, err := parseChecksums(path, b)
+		if err != nil {
+			return nil, err
+		}
+		info, ok := checksumOf(checksums, name)
+		if !ok {
+			return nil, fmt.Errorf("ReadSidecars(): %s: %w", path, ErrInvalidChecksum)
+		}
+		info.Index = index
+		info.Name = name
+		m.Parts = append(m.Parts, info)
+	}
+	if sidecars == 0 {
+		return nil, ErrNoSidecar
+	}
+	return m, nil
+}
+
+// checksumOf は checksums から name のパートの記録を探す
+// チェックサムファイルにはパートの名前がディレクトリ付きで書かれている場合もあるので、ディレクトリを除いて比べる
+func checksumOf(checksums *Manifest, name string) (PartInfo, bool) {
+	for _, info := range checksums.Parts {
+		if filepath.Base(info.Name) == name {
+			return info, true
+		}
+	}
+	return PartInfo{}, false
+}
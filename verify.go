@@ -0,0 +1,80 @@
+package main
+
+// verify サブコマンド
+// split verify [options] [prefix] で、分割したパートを記録と照合する
+// --manifest を指定した場合は split --manifest で書き出した Manifest か、sha256sum が出力する形式のチェックサムファイルと照合する
+// 指定しない場合は、パートごとのチェックサムファイル(xaa に対する xaa.sha256)と照合する
+// -a, -d, -x, --additional-suffix, --name-template には分割した時と同じ値を指定する
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/ntk221/split/splitter"
+)
+
+const VerifySynopsys = `
+	usage:	split verify [-a suffix_length] [-d | -x] [--additional-suffix suffix] [--name-template template [--input-name name]]
+			[--manifest manifest_file] [prefix]`
+
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	naming := addNamingFlags(fs)
+	manifestOption := fs.String("manifest", "", "照合するManifestかチェックサムファイルを指定してください。指定しない場合はパートごとのチェックサムファイルと照合します")
+	fs.Parse(args)
+
+	rest := fs.Args()
+	if len(rest) > 1 {
+		log.Fatal(VerifySynopsys)
+	}
+	prefix := DefaultPrefix
+	if len(rest) == 1 {
+		prefix = rest[0]
+	}
+
+	dir, s := naming.splitterFor(prefix, VerifySynopsys)
+
+	var m *splitter.Manifest
+	var err error
+	if *manifestOption != "" {
+		m, err = splitter.ReadManifest(*manifestOption)
+		// --input-name を指定しない場合は Manifest に記録された入力ファイルの名前を使う
+		// チェックサムファイルには入力ファイルの名前が記録されていないので、Input は空文字列になる
+		if err == nil && s.InputName == "" && m.Input != "" && m.Input != "-" {
+			s.InputName = m.Input
+		}
+	} else {
+		m, err = s.ReadSidecars(dir)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	results, err := s.Verify(context.Background(), dir, m)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mismatched := 0
+	for _, result := range results {
+		if result.Status == splitter.PartOK {
+			continue
+		}
+		mismatched++
+		fmt.Println(describeResult(result))
+	}
+	if mismatched > 0 {
+		log.Fatalf("%d個のパートが一致しません", mismatched)
+	}
+}
+
+// describeResult は照合結果を1行で表す
+// ex: "xab: truncated (5 of 12 bytes)"
+func describeResult(result splitter.VerifyResult) string {
+	if result.Status == splitter.PartTruncated {
+		return fmt.Sprintf("%s: %s (%d of %d bytes)", result.Name, result.Status, result.Length, result.Want)
+	}
+	return fmt.Sprintf("%s: %s", result.Name, result.Status)
+}